@@ -0,0 +1,134 @@
+package kulascope
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// batch collects records until a size or record limit is hit. The encoded
+// body of each record is kept to measure the batch.
+type batch struct {
+	records []CreateLogRequest
+	bodies  [][]byte
+	segs    []*segment // spool segment of each body, nil when not spooled
+	frames  []int      // frame index of each body in its segment
+	size    int
+}
+
+func (b *batch) add(record CreateLogRequest, body []byte, seg *segment, frame int) {
+	b.records = append(b.records, record)
+	b.bodies = append(b.bodies, body)
+	b.segs = append(b.segs, seg)
+	b.frames = append(b.frames, frame)
+	b.size += len(body)
+}
+
+func (b *batch) len() int {
+	return len(b.bodies)
+}
+
+// reset empties the batch. The records slice is not reused since
+// exporters may hold on to it.
+func (b *batch) reset() {
+	b.records = nil
+	b.bodies = b.bodies[:0]
+	b.segs = b.segs[:0]
+	b.frames = b.frames[:0]
+	b.size = 0
+}
+
+// detach moves the batch's contents to a new batch and empties this one,
+// for sends that outlive the worker's next batch
+func (b *batch) detach() *batch {
+	out := *b
+	*b = batch{}
+	return &out
+}
+
+// fits reports whether body can join the batch without exceeding the limits.
+// An empty batch accepts anything so oversized records are still sent alone.
+func (b *batch) fits(body []byte, maxRecords, maxBytes int) bool {
+	if len(b.bodies) == 0 {
+		return true
+	}
+	return len(b.bodies) < maxRecords && b.size+len(body)+1 <= maxBytes
+}
+
+// ack tells the spool that every record in the batch was delivered
+func (b *batch) ack(s *spool) {
+	if s == nil {
+		return
+	}
+	frames := make(map[*segment][]int)
+	for i, seg := range b.segs {
+		if seg != nil {
+			frames[seg] = append(frames[seg], b.frames[i])
+		}
+	}
+	for seg, f := range frames {
+		s.ack(seg, f...)
+	}
+}
+
+// encodeBodies lays encoded records out in the requested format
+func encodeBodies(bodies [][]byte, format BatchFormat) []byte {
+	size := 0
+	for _, body := range bodies {
+		size += len(body)
+	}
+	var buf bytes.Buffer
+	buf.Grow(size + len(bodies) + 2)
+
+	if format == FormatNDJSON {
+		for _, body := range bodies {
+			buf.Write(body)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes()
+	}
+
+	buf.WriteByte('[')
+	for i, body := range bodies {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(body)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+func contentTypeFor(format BatchFormat) string {
+	if format == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// zstd encoders are safe for concurrent EncodeAll calls, so one is shared
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// compress returns the encoded body and the matching Content-Encoding value
+func compress(c Compression, data []byte) ([]byte, string, error) {
+	switch c {
+	case CompressionNone:
+		return data, "", nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, "", err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "gzip", nil
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)/2)), "zstd", nil
+	default:
+		return nil, "", fmt.Errorf("unknown compression: %q", c)
+	}
+}
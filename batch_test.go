@@ -0,0 +1,153 @@
+package kulascope
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestBatchFits(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		queued     []string
+		body       string
+		maxRecords int
+		maxBytes   int
+		want       bool
+	}{
+		{"empty batch takes an oversized record", nil, "0123456789", 10, 5, true},
+		{"room left", []string{"abc"}, "def", 10, 8, true},
+		{"separator counts", []string{"abc"}, "def", 10, 6, false},
+		{"record limit", []string{"a", "b"}, "c", 2, 100, false},
+	} {
+		var b batch
+		for _, body := range tc.queued {
+			b.add(CreateLogRequest{}, []byte(body), nil, 0)
+		}
+		if got := b.fits([]byte(tc.body), tc.maxRecords, tc.maxBytes); got != tc.want {
+			t.Errorf("%s: fits = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEncodeBodies(t *testing.T) {
+	bodies := [][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)}
+	for _, tc := range []struct {
+		format BatchFormat
+		bodies [][]byte
+		want   string
+	}{
+		{FormatJSONArray, bodies, `[{"a":1},{"b":2}]`},
+		{FormatJSONArray, nil, `[]`},
+		{FormatNDJSON, bodies, "{\"a\":1}\n{\"b\":2}\n"},
+	} {
+		if got := string(encodeBodies(tc.bodies, tc.format)); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.format, got, tc.want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"message":"http request completed"}`), 100)
+	for _, tc := range []struct {
+		c        Compression
+		encoding string
+		decode   func([]byte) ([]byte, error)
+	}{
+		{CompressionNone, "", func(b []byte) ([]byte, error) { return b, nil }},
+		{CompressionGzip, "gzip", func(b []byte) ([]byte, error) {
+			zr, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(zr)
+		}},
+		{CompressionZstd, "zstd", func(b []byte) ([]byte, error) {
+			zr, err := zstd.NewReader(nil)
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+			return zr.DecodeAll(b, nil)
+		}},
+	} {
+		body, encoding, err := compress(tc.c, data)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.c, err)
+		}
+		if encoding != tc.encoding {
+			t.Errorf("%s: Content-Encoding = %q, want %q", tc.c, encoding, tc.encoding)
+		}
+		got, err := tc.decode(body)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: round trip failed: %v", tc.c, err)
+		}
+	}
+	if _, _, err := compress("brotli", data); err == nil {
+		t.Error("unknown compression accepted")
+	}
+}
+
+func TestBatchRecordLimit(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		sizes []int
+	)
+	client, err := New(Config{
+		APIKey:          "test",
+		Compression:     CompressionGzip,
+		BatchFormat:     FormatNDJSON,
+		BatchMaxRecords: 3,
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Header.Get("Content-Encoding") != "gzip" {
+				t.Errorf("Content-Encoding = %q", r.Header.Get("Content-Encoding"))
+			}
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return &http.Response{StatusCode: http.StatusBadRequest, Body: http.NoBody}, nil
+			}
+			n := 0
+			for dec := json.NewDecoder(zr); dec.More(); n++ {
+				var rec CreateLogRequest
+				if err := dec.Decode(&rec); err != nil {
+					t.Error(err)
+					break
+				}
+			}
+			mu.Lock()
+			sizes = append(sizes, n)
+			mu.Unlock()
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown(context.Background())
+
+	for range 7 {
+		client.enqueue(CreateLogRequest{Message: "m", Metadata: map[string]any{}})
+	}
+	if n, err := client.Flush(context.Background()); n != 0 || err != nil {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+
+	total := 0
+	for _, n := range sizes {
+		if n > 3 {
+			t.Errorf("batch of %d records, want at most 3", n)
+		}
+		total += n
+	}
+	if total != 7 {
+		t.Errorf("sent %d records in %v, want 7", total, sizes)
+	}
+}
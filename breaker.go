@@ -0,0 +1,128 @@
+package kulascope
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is a circuit breaker around the exporter. It opens after a run
+// of consecutive failed attempts; while open, senders wait instead of
+// burning their retries. After the cooldown a single probe is let through:
+// success closes the breaker, failure opens it again.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	// onChange is called with each new state while mu is held, so the
+	// states are reported in order
+	onChange func(breakerState)
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	// changed is closed and replaced on every state change
+	changed chan struct{}
+}
+
+func newBreaker(threshold int, cooldown time.Duration, onChange func(breakerState)) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		onChange:  onChange,
+		changed:   make(chan struct{}),
+	}
+}
+
+// acquire blocks until an attempt may be made: the breaker is closed, or
+// the cooldown is over and this caller holds the half-open probe. Every
+// successful acquire must be followed by record.
+func (b *breaker) acquire(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		var wait time.Duration
+		switch b.state {
+		case breakerClosed:
+			b.mu.Unlock()
+			return nil
+		case breakerOpen:
+			wait = b.cooldown - time.Since(b.openedAt)
+			if wait <= 0 {
+				b.setState(breakerHalfOpen)
+				b.mu.Unlock()
+				return nil
+			}
+		case breakerHalfOpen:
+			// another sender is probing, wait for its outcome
+			wait = b.cooldown
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// record reports the outcome of an attempt
+func (b *breaker) record(ok bool) {
+	b.mu.Lock()
+	if ok {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+		}
+		b.mu.Unlock()
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+	b.mu.Unlock()
+}
+
+// current returns the breaker's state
+func (b *breaker) current() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// setState must be called with mu held
+func (b *breaker) setState(s breakerState) {
+	b.state = s
+	close(b.changed)
+	b.changed = make(chan struct{})
+	if b.onChange != nil {
+		b.onChange(s)
+	}
+}
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
@@ -0,0 +1,72 @@
+package kulascope
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	var states []breakerState
+	b := newBreaker(3, 20*time.Millisecond, func(s breakerState) { states = append(states, s) })
+	ctx := context.Background()
+
+	for _, step := range []struct {
+		name string
+		ok   bool
+		want breakerState
+	}{
+		{"first failure", false, breakerClosed},
+		{"success resets the run", true, breakerClosed},
+		{"failure 1", false, breakerClosed},
+		{"failure 2", false, breakerClosed},
+		{"failure 3 opens", false, breakerOpen},
+	} {
+		if err := b.acquire(ctx); err != nil {
+			t.Fatalf("%s: acquire: %v", step.name, err)
+		}
+		b.record(step.ok)
+		if got := b.current(); got != step.want {
+			t.Fatalf("%s: state = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	// open: callers wait out the cooldown, then one probe goes through
+	short, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	if err := b.acquire(short); err == nil {
+		t.Fatal("acquire succeeded while open")
+	}
+	if err := b.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.current(); got != breakerHalfOpen {
+		t.Fatalf("state after cooldown = %v, want half-open", got)
+	}
+
+	// a second caller waits for the probe's outcome
+	probe, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	if err := b.acquire(probe); err == nil {
+		t.Fatal("second caller acquired during the half-open probe")
+	}
+
+	// a failed probe opens it again, a successful one closes it
+	b.record(false)
+	if got := b.current(); got != breakerOpen {
+		t.Fatalf("state after failed probe = %v, want open", got)
+	}
+	if err := b.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b.record(true)
+	if got := b.current(); got != breakerClosed {
+		t.Fatalf("state after successful probe = %v, want closed", got)
+	}
+
+	want := []breakerState{breakerOpen, breakerHalfOpen, breakerOpen, breakerHalfOpen, breakerClosed}
+	if !slices.Equal(states, want) {
+		t.Errorf("state changes %v, want %v", states, want)
+	}
+}
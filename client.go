@@ -0,0 +1,341 @@
+package kulascope
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kulawise/kulascope-go-sdk/log"
+	"github.com/kulawise/kulascope-go-sdk/redact"
+	"github.com/rs/zerolog"
+)
+
+// Client owns everything needed to capture and deliver logs: its own
+// queues, workers, HTTP client and redaction rules. Several clients can
+// run side by side, e.g. one per Fiber app or per test.
+type Client struct {
+	cfg        Config
+	logger     zerolog.Logger
+	httpClient *http.Client // used by the default exporter
+	exporter   Exporter
+	fanout     *fanoutExporter // set when exporter is a fan-out
+
+	headerRules   redact.Redactor
+	requestRules  redact.Redactor
+	responseRules redact.Redactor
+
+	logChan   chan func(zerolog.Logger)
+	sendQueue chan sendJob
+	spool     *spool
+	breaker   *breaker
+
+	routeMetrics *routeMetrics // nil with DisableRouteMetrics
+
+	includeRoutes []*regexp.Regexp
+	excludeRoutes []*regexp.Regexp
+	routePolicies []routePolicy
+
+	// overflow holds records spilled by OverflowSpill until the drainer
+	// queues them again
+	overflow     *spool
+	overflowWake chan struct{}
+	stopOverflow chan struct{}
+	overflowDone chan struct{}
+
+	// accepting is cleared by Shutdown. enqueue and AsyncLog hold acceptMu
+	// for reading while they check it and queue, so Shutdown can wait for
+	// those that got in first; stopping wakes any blocked on a full queue.
+	accepting atomic.Bool
+	acceptMu  sync.RWMutex
+	stopping  chan struct{}
+	// pending counts records queued for delivery that have not yet been
+	// delivered or given up on; failed counts records that were given up on
+	pending atomic.Int64
+	failed  atomic.Int64
+	// dropped counts failed records dropped by the overflow policy;
+	// spilled counts records written to the overflow spool
+	dropped atomic.Int64
+	spilled atomic.Int64
+	// sampledOut counts requests sampling decided not to capture
+	sampledOut atomic.Int64
+	// delivered, batches and bytesSent count what the exporter accepted
+	delivered atomic.Int64
+	batches   atomic.Int64
+	bytesSent atomic.Int64
+	// deadLettered counts records handed to the dead-letter sink
+	deadLettered atomic.Int64
+	exports      exportStats
+	// rejected counts batches the exporter refused outright; lastRejection
+	// holds the latest error, returned by Flush and Shutdown
+	rejected      atomic.Int64
+	lastRejection atomic.Pointer[error]
+	// logPending counts AsyncLog calls not yet written out; logDropped
+	// counts those dropped because the log queue was full
+	logPending atomic.Int64
+	logDropped atomic.Int64
+
+	ctx          context.Context
+	cancel       context.CancelFunc
+	senderWG     sync.WaitGroup
+	stopSenders  chan struct{}
+	flushSignals []chan struct{}
+	stopLog      chan struct{}
+	logDone      chan struct{}
+}
+
+// New creates a Client and starts its workers. It fails if the config is
+// invalid, e.g. a redact path does not parse, or the spool cannot be opened.
+func New(cfg Config) (*Client, error) {
+	cfg.setDefaults()
+	if cfg.Sampling != nil {
+		if err := cfg.Sampling.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.QueueOverflow == OverflowSpill && cfg.OverflowDir == "" {
+		return nil, errors.New("kulascope: OverflowSpill needs OverflowDir or SpoolDir")
+	}
+	cfg.RedactRequestBody = mergeRedactKeys(defaultRedactBodyKeys, cfg.RedactRequestBody)
+	cfg.RedactResponseBody = mergeRedactKeys(defaultRedactBodyKeys, cfg.RedactResponseBody)
+	cfg.RedactHeaders = mergeRedactKeys(defaultRedactHeaderKeys, cfg.RedactHeaders)
+
+	headerRules, err := compileRules(cfg.RedactHeaders, cfg)
+	if err != nil {
+		return nil, err
+	}
+	requestRules, err := compileRules(cfg.RedactRequestBody, cfg)
+	if err != nil {
+		return nil, err
+	}
+	responseRules, err := compileRules(cfg.RedactResponseBody, cfg)
+	if err != nil {
+		return nil, err
+	}
+	logRules, err := compileLogRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	includeRoutes, err := compileRoutePatterns(cfg.IncludeRoutes)
+	if err != nil {
+		return nil, err
+	}
+	excludeRoutes, err := compileRoutePatterns(cfg.ExcludeRoutes)
+	if err != nil {
+		return nil, err
+	}
+	routePolicies, err := compileRoutePolicies(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := ingestEndpoint(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	zerolog.DurationFieldUnit = time.Millisecond
+
+	c := &Client{
+		cfg:        cfg,
+		logger:     newLogger(os.Stdout, cfg, logRules),
+		httpClient: httpClient,
+
+		headerRules:   headerRules,
+		requestRules:  requestRules,
+		responseRules: responseRules,
+
+		includeRoutes: includeRoutes,
+		excludeRoutes: excludeRoutes,
+		routePolicies: routePolicies,
+
+		logChan:     make(chan func(zerolog.Logger), 100_000),
+		sendQueue:   make(chan sendJob, cfg.QueueSize),
+		stopping:    make(chan struct{}),
+		stopSenders: make(chan struct{}),
+		stopLog:     make(chan struct{}),
+		logDone:     make(chan struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	c.exporter = cfg.Exporter
+	if c.exporter == nil {
+		c.exporter = NewHTTPExporter(HTTPExporterConfig{
+			APIKey:      cfg.APIKey,
+			URL:         endpoint,
+			Compression: cfg.Compression,
+			Format:      cfg.BatchFormat,
+			Client:      c.httpClient,
+			Timeout:     cfg.RequestTimeout,
+		})
+	}
+
+	if !cfg.DisableRouteMetrics {
+		c.routeMetrics = newRouteMetrics(cfg.LatencyBuckets, cfg.MetricsMaxRoutes)
+	}
+	if !cfg.DisableBreaker {
+		c.breaker = newBreaker(cfg.BreakerFailures, cfg.BreakerCooldown, func(s breakerState) {
+			c.logger.Warn().Stringer("state", s).Msg("ingest circuit breaker changed state")
+		})
+	}
+	if f, ok := c.exporter.(*fanoutExporter); ok {
+		c.fanout = f
+		f.start(cfg.Retry, c.sinkBreaker, &c.exports)
+	}
+
+	var replay []replayBatch
+	if cfg.SpoolDir != "" {
+		s, pending, err := openSpool(cfg)
+		if err != nil {
+			c.cancel()
+			return nil, err
+		}
+		c.spool = s
+		replay = pending
+	}
+	if cfg.QueueOverflow == OverflowSpill {
+		if err := c.openOverflow(); err != nil {
+			c.cancel()
+			if c.spool != nil {
+				c.spool.close()
+			}
+			return nil, err
+		}
+	}
+
+	c.accepting.Store(true)
+	c.startLogWorker()
+	c.startSenderWorkers()
+	if c.overflow != nil {
+		go c.overflowDrainer()
+	}
+	if cfg.SelfReportInterval > 0 {
+		go c.selfReporter()
+	}
+	if cfg.RouteMetricsInterval > 0 && c.routeMetrics != nil {
+		go c.routeReporter()
+	}
+
+	if len(replay) > 0 {
+		// counted now so a Flush right after New waits for them
+		for _, rb := range replay {
+			c.pending.Add(int64(len(rb.bodies)))
+		}
+		c.senderWG.Add(1)
+		go c.replaySpool(replay)
+	}
+
+	return c, nil
+}
+
+// sinkBreaker returns the circuit breaker for one exporter behind a
+// fan-out, or nil with DisableBreaker
+func (c *Client) sinkBreaker(sink int) *breaker {
+	if c.cfg.DisableBreaker {
+		return nil
+	}
+	return newBreaker(c.cfg.BreakerFailures, c.cfg.BreakerCooldown, func(s breakerState) {
+		c.logger.Warn().Int("exporter", sink).Stringer("state", s).Msg("exporter circuit breaker changed state")
+	})
+}
+
+// newLogger returns the client's stdout logger. Lines carry the same fields
+// as sub-log metadata, so they are redacted with the same rules, except that
+// the lines' own field names only match key rules exactly.
+func newLogger(out io.Writer, cfg Config, rules redact.Redactor) zerolog.Logger {
+	w := redact.NewWriter(out, rules)
+	return zerolog.New(zerolog.SyncWriter(w)).With().
+		Timestamp().
+		Str("env", string(cfg.Environment)).
+		Logger()
+}
+
+// newContext attaches a per-request EventLogger, the trace context and the
+// client itself to ctx
+func (c *Client) newContext(ctx context.Context, sc spanContext) context.Context {
+	ctx = context.WithValue(ctx, clientKey, c)
+	ctx = withSpanContext(ctx, sc)
+	events := log.NewEventLogger(ctx, &c.logger, sc.traceID)
+	events.SetRedactor(c.requestRules)
+	return log.WithLogger(ctx, events)
+}
+
+// clientFromContext returns the client handling the current request,
+// falling back to the default client
+func clientFromContext(ctx context.Context) *Client {
+	if c, ok := ctx.Value(clientKey).(*Client); ok {
+		return c
+	}
+	return getDefault()
+}
+
+// Logger returns the client's stdout logger
+func (c *Client) Logger() zerolog.Logger {
+	return c.logger
+}
+
+// the default client backs the package-level API
+var (
+	defaultMu      sync.RWMutex
+	defaultClient  *Client
+	managedClients []*Client
+)
+
+// Init creates a client and makes it the default used by the package-level
+// functions. Clients created through Init or Middleware are all drained by
+// the package-level Shutdown and Flush. If cfg is invalid the error is
+// written to stderr and no default client is set; use InitE to handle it.
+func Init(cfg Config) {
+	if err := InitE(cfg); err != nil {
+		logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+		logger.Error().Err(err).Msg("kulascope: init failed")
+	}
+}
+
+// InitE is Init but returns the error from New instead of logging it
+func InitE(cfg Config) error {
+	c, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	setDefault(c)
+	return nil
+}
+
+func setDefault(c *Client) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultClient = c
+	managedClients = append(managedClients, c)
+}
+
+// getDefault returns the default client, or nil before Init
+func getDefault() *Client {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultClient
+}
+
+func takeManaged() []*Client {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	clients := managedClients
+	managedClients = nil
+	return clients
+}
+
+func listManaged() []*Client {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return append([]*Client(nil), managedClients...)
+}
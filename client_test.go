@@ -0,0 +1,69 @@
+package kulascope
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientsAreIsolated(t *testing.T) {
+	var gotA, gotB atomic.Int64
+	newClient := func(got *atomic.Int64) *Client {
+		t.Helper()
+		c, err := New(Config{
+			APIKey: "test",
+			Exporter: exporterFunc(func(_ context.Context, records []CreateLogRequest) error {
+				got.Add(int64(len(records)))
+				return nil
+			}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	a, b := newClient(&gotA), newClient(&gotB)
+	defer b.Shutdown(context.Background())
+
+	for range 3 {
+		a.enqueue(CreateLogRequest{Level: "info", Message: "a", Timestamp: time.Now()})
+	}
+	b.enqueue(CreateLogRequest{Level: "info", Message: "b", Timestamp: time.Now()})
+
+	if n, err := a.Shutdown(context.Background()); n != 0 || err != nil {
+		t.Fatalf("a.Shutdown = %d, %v", n, err)
+	}
+	if n, err := b.Flush(context.Background()); n != 0 || err != nil {
+		t.Fatalf("b.Flush = %d, %v", n, err)
+	}
+	if gotA.Load() != 3 || gotB.Load() != 1 {
+		t.Fatalf("exporters got %d and %d records, want 3 and 1", gotA.Load(), gotB.Load())
+	}
+	if sa, sb := a.Stats(), b.Stats(); sa.Delivered != 3 || sb.Delivered != 1 {
+		t.Fatalf("stats delivered %d and %d, want 3 and 1", sa.Delivered, sb.Delivered)
+	}
+
+	// b keeps running after a has shut down
+	b.enqueue(CreateLogRequest{Level: "info", Message: "b", Timestamp: time.Now()})
+	a.enqueue(CreateLogRequest{Level: "info", Message: "a", Timestamp: time.Now()})
+	if n, err := b.Flush(context.Background()); n != 0 || err != nil {
+		t.Fatalf("b.Flush after a.Shutdown = %d, %v", n, err)
+	}
+	if gotA.Load() != 3 || gotB.Load() != 2 {
+		t.Fatalf("exporters got %d and %d records, want 3 and 2", gotA.Load(), gotB.Load())
+	}
+	if f := a.Stats().Failed; f != 1 {
+		t.Fatalf("a failed %d records after Shutdown, want 1", f)
+	}
+}
+
+func TestInitE(t *testing.T) {
+	if err := InitE(Config{APIKey: "test", RedactRequestBody: []string{"$.["}}); err == nil {
+		t.Fatal("InitE accepted an invalid redact path")
+	}
+	Init(Config{APIKey: "test", RedactRequestBody: []string{"$.["}})
+	if getDefault() != nil {
+		t.Fatal("Init set a default client from an invalid config")
+	}
+}
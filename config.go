@@ -1,5 +1,11 @@
 package kulascope
 
+import (
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
 type Environment string
 
 const (
@@ -7,6 +13,29 @@ const (
 	Production Environment = "production"
 )
 
+// Compression selects how batch bodies are encoded on the wire
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// BatchFormat selects how records are laid out inside a batch body
+type BatchFormat string
+
+const (
+	// FormatJSONArray sends a batch as a single JSON array
+	FormatJSONArray BatchFormat = "json"
+	// FormatNDJSON sends a batch as newline-delimited JSON objects
+	FormatNDJSON BatchFormat = "ndjson"
+)
+
+// defaultMaxBodyBytes is the default for MaxRequestBodyBytes and
+// MaxResponseBodyBytes
+const defaultMaxBodyBytes = 64 << 10
+
 type Config struct {
 	Environment        Environment
 	APIKey             string
@@ -14,4 +43,219 @@ type Config struct {
 	RedactRequestBody  []string
 	RedactResponseBody []string
 	WorkerCount        int
+
+	// RedactKeyMatch controls how key-name rules match (default KeyMatchSubstring).
+	// Rules starting with $ are path expressions and always match exactly.
+	RedactKeyMatch KeyMatchMode
+	// Detectors scan string values and mask matches even under innocent keys,
+	// e.g. DefaultDetectors(). Off by default.
+	Detectors []Detector
+	// RedactStrategies picks how matched values are replaced, keyed by a rule
+	// from the redact lists or by a detector label, e.g.
+	// {"card_number": PartialMask(4), "email": Pseudonymize()}.
+	// Anything not listed uses FullRedact.
+	RedactStrategies map[string]Strategy
+	// RedactSecret is the HMAC key for Pseudonymize. It is never sent.
+	RedactSecret []byte
+
+	// BatchMaxRecords caps how many records go into one request (default 500)
+	BatchMaxRecords int
+	// BatchMaxBytes caps the uncompressed size of one request body (default 1MB)
+	BatchMaxBytes int
+	// BatchInterval is how long a partial batch may wait before it is sent (default 1s)
+	BatchInterval time.Duration
+	// Compression defaults to gzip
+	Compression Compression
+	// BatchFormat defaults to a JSON array
+	BatchFormat BatchFormat
+	// BaseURL points the default exporter at another ingest host, e.g. a
+	// local mock; batches are posted to BaseURL + /kulascope/logs
+	BaseURL string
+	// HTTPClient is used as-is by the default exporter
+	HTTPClient *http.Client
+	// Transport is used when HTTPClient is not set
+	Transport http.RoundTripper
+	// RequestTimeout bounds each attempt to deliver a batch, so a hung
+	// ingest API cannot block a sender worker (default 10s)
+	RequestTimeout time.Duration
+	// ProxyURL routes ingest requests through a proxy. By default the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply.
+	ProxyURL string
+	// CAFile is a PEM bundle of CAs trusted for the ingest API instead of the
+	// system roots
+	CAFile string
+	// ClientCertFile and ClientKeyFile hold a PEM key pair for mTLS
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// Retry controls backoff between delivery attempts. A 429 or 503 with
+	// Retry-After waits as long as the server asks, up to MaxBackoff; other
+	// 4xx responses, e.g. 400, 401 or 413, are not retried.
+	Retry RetryPolicy
+	// DeadLetter receives batches that were rejected or ran out of retries,
+	// e.g. NewFileDeadLetter. With a spool configured, a batch is only
+	// dropped from the spool once the dead-letter sink accepts it.
+	DeadLetter DeadLetter
+
+	// BreakerFailures is how many consecutive failed attempts open the
+	// circuit breaker around the exporter (default 5). While it is open,
+	// batches wait instead of being retried, and after BreakerCooldown
+	// (default 30s) a single batch probes whether the exporter recovered.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+	// DisableBreaker turns the circuit breaker off
+	DisableBreaker bool
+
+	// QueueSize is how many records may wait for the sender workers
+	// (default 50,000)
+	QueueSize int
+	// QueueOverflow decides what happens to a record when the queue is
+	// full (default OverflowDropOldest). Every policy except OverflowBlock
+	// keeps the request path independent of the ingest API.
+	QueueOverflow OverflowPolicy
+	// OverflowDir is where OverflowSpill writes records (default
+	// SpoolDir/overflow). Its size is bounded by SpoolMaxBytes.
+	OverflowDir string
+
+	// SelfReportInterval, when set, sends the client's Stats as a record
+	// with the message "kulascope sdk stats" at that interval
+	SelfReportInterval time.Duration
+
+	// IncludeRoutes, when set, limits capture to request paths matching
+	// one of these patterns, and ExcludeRoutes skips matching paths, e.g.
+	// "/healthz", "/static/**" or "regexp:^/internal/". Skipped requests
+	// are passed straight through: no record, no metrics. gRPC calls
+	// match on the full method.
+	IncludeRoutes []string
+	ExcludeRoutes []string
+	// RoutePolicies set what is captured for matching request paths; the
+	// first match wins. They apply to HTTP requests.
+	RoutePolicies []RoutePolicy
+
+	// MaxRequestBodyBytes and MaxResponseBodyBytes cap how much of each
+	// HTTP body or gRPC message is captured (default 64KB each, -1 for no
+	// limit). A longer body is cut before it is redacted and recorded with
+	// request_body_truncated or response_body_truncated set; its full size
+	// stays in request_size or response_size.
+	MaxRequestBodyBytes  int
+	MaxResponseBodyBytes int
+
+	// Sampling, when set, captures only a share of requests; see Sampling.
+	// By default every request is captured.
+	Sampling *Sampling
+
+	// RouteMetricsInterval, when set, sends per method and route request
+	// counts, server errors and duration histograms as a record at that
+	// interval. The same totals are always served by MetricsHandler.
+	RouteMetricsInterval time.Duration
+	// LatencyBuckets are the upper bounds of the duration histogram
+	// (default DefaultLatencyBuckets)
+	LatencyBuckets []time.Duration
+	// MetricsMaxRoutes caps how many method and route pairs are tracked;
+	// further ones are counted under the route "other" (default 1000)
+	MetricsMaxRoutes int
+	// DisableRouteMetrics turns the per-route aggregation off
+	DisableRouteMetrics bool
+	// RoutePattern returns the route template of a net/http request when
+	// ServeMux's r.Pattern is not enough, e.g. for chi. It is recorded as
+	// the record's Route and used for the route metrics:
+	//   func(r *http.Request) string { return chi.RouteContext(r.Context()).RoutePattern() }
+	RoutePattern func(*http.Request) string
+	// RouteParams returns the path parameters of a net/http request when
+	// they do not come from ServeMux wildcards, e.g. chi's URLParams
+	RouteParams func(*http.Request) map[string]string
+
+	// Exporter receives every batch. It defaults to the Kulascope HTTP
+	// exporter built from the settings above.
+	// The client shuts it down on Shutdown.
+	Exporter Exporter
+
+	// SpoolDir enables the on-disk write-ahead spool when set. Records are
+	// written here before being queued and replayed on the next start if
+	// they were never acknowledged.
+	SpoolDir string
+	// SpoolSegmentBytes is the size at which a segment file is rotated (default 16MB)
+	SpoolSegmentBytes int64
+	// SpoolMaxBytes is the disk budget; the oldest segments are evicted past it (default 512MB)
+	SpoolMaxBytes int64
+	// SpoolSync defaults to SyncInterval
+	SpoolSync SyncPolicy
+	// SpoolSyncInterval is used with SyncInterval (default 1s)
+	SpoolSyncInterval time.Duration
+
+	// TraceResponseHeader is the response header the trace ID is echoed in (default X-Trace-ID)
+	TraceResponseHeader string
+	// DisableTraceResponseHeader stops the trace ID from being echoed back
+	DisableTraceResponseHeader bool
+}
+
+// setDefaults fills in zero values with safe defaults
+func (cfg *Config) setDefaults() {
+	if cfg.WorkerCount <= 0 {
+		cfg.WorkerCount = 4
+	}
+	if cfg.RedactKeyMatch == "" {
+		cfg.RedactKeyMatch = KeyMatchSubstring
+	}
+	if cfg.BatchMaxRecords <= 0 {
+		cfg.BatchMaxRecords = 500
+	}
+	if cfg.BatchMaxBytes <= 0 {
+		cfg.BatchMaxBytes = 1 << 20
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = 10 * time.Second
+	}
+	cfg.Retry.setDefaults()
+	if cfg.BatchInterval <= 0 {
+		cfg.BatchInterval = time.Second
+	}
+	if cfg.Compression == "" {
+		cfg.Compression = CompressionGzip
+	}
+	if cfg.BatchFormat == "" {
+		cfg.BatchFormat = FormatJSONArray
+	}
+	if cfg.BreakerFailures <= 0 {
+		cfg.BreakerFailures = 5
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = 30 * time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 50_000
+	}
+	if cfg.QueueOverflow == "" {
+		cfg.QueueOverflow = OverflowDropOldest
+	}
+	if cfg.OverflowDir == "" && cfg.SpoolDir != "" {
+		cfg.OverflowDir = filepath.Join(cfg.SpoolDir, "overflow")
+	}
+	if cfg.MaxRequestBodyBytes == 0 {
+		cfg.MaxRequestBodyBytes = defaultMaxBodyBytes
+	}
+	if cfg.MaxResponseBodyBytes == 0 {
+		cfg.MaxResponseBodyBytes = defaultMaxBodyBytes
+	}
+	if len(cfg.LatencyBuckets) == 0 {
+		cfg.LatencyBuckets = DefaultLatencyBuckets
+	}
+	if cfg.MetricsMaxRoutes <= 0 {
+		cfg.MetricsMaxRoutes = 1000
+	}
+	if cfg.SpoolSegmentBytes <= 0 {
+		cfg.SpoolSegmentBytes = 16 << 20
+	}
+	if cfg.SpoolMaxBytes <= 0 {
+		cfg.SpoolMaxBytes = 512 << 20
+	}
+	if cfg.SpoolSync == "" {
+		cfg.SpoolSync = SyncInterval
+	}
+	if cfg.SpoolSyncInterval <= 0 {
+		cfg.SpoolSyncInterval = time.Second
+	}
+	if cfg.TraceResponseHeader == "" {
+		cfg.TraceResponseHeader = "X-Trace-ID"
+	}
 }
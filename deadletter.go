@@ -0,0 +1,126 @@
+package kulascope
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter receives batches the exporter rejected or that ran out of
+// retries, with the last error, so they can be inspected and replayed
+type DeadLetter interface {
+	WriteDeadLetter(records []CreateLogRequest, err error) error
+}
+
+// DeadLetterFunc adapts a function to DeadLetter
+type DeadLetterFunc func(records []CreateLogRequest, err error) error
+
+func (f DeadLetterFunc) WriteDeadLetter(records []CreateLogRequest, err error) error {
+	return f(records, err)
+}
+
+// deadLetterEntry is one line of a dead-letter file
+type deadLetterEntry struct {
+	Time   time.Time        `json:"time"`
+	Error  string           `json:"error"`
+	Record CreateLogRequest `json:"record"`
+}
+
+type fileDeadLetter struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileDeadLetter returns a sink that appends each record to the file at
+// path as one line of JSON, alongside the error and time it failed.
+// Client.ReplayDeadLetter sends the file again.
+func NewFileDeadLetter(path string) (DeadLetter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("kulascope: open dead-letter file: %w", err)
+	}
+	f.Close()
+	return &fileDeadLetter{path: path}, nil
+}
+
+// WriteDeadLetter opens the file for each batch, so a replay can move it
+// aside while the client keeps running
+func (d *fileDeadLetter) WriteDeadLetter(records []CreateLogRequest, cause error) error {
+	var buf []byte
+	now := time.Now().UTC()
+	for _, r := range records {
+		line, err := json.Marshal(deadLetterEntry{Time: now, Error: cause.Error(), Record: r})
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, err := os.OpenFile(d.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReplayDeadLetter queues every record in a file written by
+// NewFileDeadLetter for delivery again and returns how many were queued.
+// The file is moved to path + ".replaying" while it is read and removed
+// once every record is queued; records that fail again are written back
+// to the dead-letter sink. A ".replaying" file left by an interrupted
+// replay is picked up first.
+func (c *Client) ReplayDeadLetter(path string) (int, error) {
+	replaying := path + ".replaying"
+	if _, err := os.Stat(replaying); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Rename(path, replaying); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return 0, nil
+			}
+			return 0, fmt.Errorf("kulascope: replay dead letters: %w", err)
+		}
+	}
+
+	f, err := os.Open(replaying)
+	if err != nil {
+		return 0, fmt.Errorf("kulascope: replay dead letters: %w", err)
+	}
+	defer f.Close()
+
+	var records []CreateLogRequest
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry deadLetterEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return 0, fmt.Errorf("kulascope: replay dead letters: line %d: %w", line, err)
+		}
+		records = append(records, entry.Record)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("kulascope: replay dead letters: %w", err)
+	}
+
+	for i, r := range records {
+		// wait for room rather than dropping what is being recovered
+		if !c.enqueueWith(r, OverflowBlock) {
+			// the file is kept, so the next replay sends the first i again
+			return i, errors.New("kulascope: replay dead letters: client is shut down")
+		}
+	}
+	f.Close()
+	return len(records), os.Remove(replaying)
+}
@@ -0,0 +1,169 @@
+package kulascope
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Exporter delivers batches of records. The client's sender workers call
+// Export concurrently and retry the batch when it returns an error, unless
+// the error is an *HTTPError that is not retryable or is wrapped with
+// Permanent. Shutdown is called once, after the last Export.
+type Exporter interface {
+	Export(ctx context.Context, records []CreateLogRequest) error
+	Shutdown(ctx context.Context) error
+}
+
+// HTTPExporterConfig configures the Kulascope HTTP exporter
+type HTTPExporterConfig struct {
+	Environment Environment
+	APIKey      string
+	// URL overrides the ingest endpoint picked from Environment
+	URL string
+	// Compression defaults to gzip
+	Compression Compression
+	// Format defaults to a JSON array
+	Format BatchFormat
+	// Client defaults to a new http.Client
+	Client *http.Client
+	// Timeout bounds each request (default 10s)
+	Timeout time.Duration
+}
+
+type httpExporter struct {
+	cfg HTTPExporterConfig
+}
+
+// NewHTTPExporter returns an exporter that posts batches to the Kulascope
+// ingest API. Without an API key, batches are discarded.
+func NewHTTPExporter(cfg HTTPExporterConfig) Exporter {
+	if cfg.URL == "" {
+		cfg.URL = ingestURL(cfg.Environment)
+	}
+	if cfg.Compression == "" {
+		cfg.Compression = CompressionGzip
+	}
+	if cfg.Format == "" {
+		cfg.Format = FormatJSONArray
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &httpExporter{cfg: cfg}
+}
+
+func ingestURL(env Environment) string {
+	if env == Staging {
+		return "https://api.staging.kulawise.com/kulascope/logs"
+	}
+	return "https://api.kulawise.com/kulascope/logs"
+}
+
+func (e *httpExporter) Export(ctx context.Context, records []CreateLogRequest) error {
+	if e.cfg.APIKey == "" {
+		return nil
+	}
+
+	data, err := encodeRecords(records, e.cfg.Format)
+	if err != nil {
+		return err
+	}
+	body, encoding, err := compress(e.cfg.Compression, data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeFor(e.cfg.Format))
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	req.Header.Set("x-api-key", e.cfg.APIKey)
+
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newHTTPError(resp)
+	}
+	return nil
+}
+
+func (e *httpExporter) Shutdown(context.Context) error {
+	e.cfg.Client.CloseIdleConnections()
+	return nil
+}
+
+// encodeRecords lays records out in the requested format
+func encodeRecords(records []CreateLogRequest, format BatchFormat) ([]byte, error) {
+	bodies := make([][]byte, len(records))
+	for i, r := range records {
+		body, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		bodies[i] = body
+	}
+	return encodeBodies(bodies, format), nil
+}
+
+type writerExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewWriterExporter returns an exporter that writes each record as one
+// line of JSON to w, e.g. os.Stdout
+func NewWriterExporter(w io.Writer) Exporter {
+	return &writerExporter{w: w}
+}
+
+// NewFileExporter returns an exporter that appends NDJSON records to the
+// file at path, creating it if needed
+func NewFileExporter(path string) (Exporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("kulascope: open export file: %w", err)
+	}
+	return &writerExporter{w: f, closer: f}, nil
+}
+
+func (e *writerExporter) Export(_ context.Context, records []CreateLogRequest) error {
+	data, err := encodeRecords(records, FormatNDJSON)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *writerExporter) Shutdown(context.Context) error {
+	if e.closer == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closer.Close()
+}
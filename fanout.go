@@ -0,0 +1,129 @@
+package kulascope
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// fanoutQueueSize is how many batches may wait for one sink. A sink that
+// falls further behind fails the batches it has no room for.
+const fanoutQueueSize = 64
+
+var errSinkBacklog = errors.New("kulascope: exporter queue is full")
+
+// fanoutSink is one exporter behind a fan-out, with a queue and a worker of
+// its own so a slow or failing sink does not hold up the others
+type fanoutSink struct {
+	exporter Exporter
+	retry    retrier
+	queue    chan fanoutJob
+}
+
+// fanoutJob is a batch waiting for one sink
+type fanoutJob struct {
+	ctx     context.Context
+	records []CreateLogRequest
+	done    func(error)
+}
+
+type fanoutExporter struct {
+	sinks []*fanoutSink
+	// retry is what Export uses when no client runs the sinks
+	retry retrier
+
+	startOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewFanoutExporter returns an exporter that sends every batch to each of
+// the given exporters. A client delivers to each one independently: every
+// exporter has its own queue, retries and circuit breaker, and a batch an
+// exporter gives up on goes to the dead-letter sink for that exporter
+// alone. Spooled records are kept until every exporter has delivered or
+// dead-lettered them.
+func NewFanoutExporter(exporters ...Exporter) Exporter {
+	var policy RetryPolicy
+	policy.setDefaults()
+	f := &fanoutExporter{retry: retrier{policy: policy}}
+	for _, e := range exporters {
+		f.sinks = append(f.sinks, &fanoutSink{exporter: e})
+	}
+	return f
+}
+
+// Export sends records to every exporter at once and waits for all of
+// them. Clients do not call it; they hand each exporter the batch through
+// send instead.
+func (f *fanoutExporter) Export(ctx context.Context, records []CreateLogRequest) error {
+	errs := make([]error, len(f.sinks))
+	var wg sync.WaitGroup
+	for i, s := range f.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f.retry.export(ctx, s.exporter, records); err != nil {
+				errs[i] = fmt.Errorf("kulascope: exporter %d: %w", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return Permanent(err)
+	}
+	return nil
+}
+
+// start runs a worker per exporter, retrying per policy through the
+// breaker newBreaker returns for it, if any. Only the first call counts.
+func (f *fanoutExporter) start(policy RetryPolicy, newBreaker func(sink int) *breaker, stats *exportStats) {
+	f.startOnce.Do(func() {
+		for i, s := range f.sinks {
+			s.retry = retrier{policy: policy, breaker: newBreaker(i), stats: stats}
+			s.queue = make(chan fanoutJob, fanoutQueueSize)
+			f.wg.Add(1)
+			go func() {
+				defer f.wg.Done()
+				for job := range s.queue {
+					job.done(s.retry.export(job.ctx, s.exporter, job.records))
+				}
+			}()
+		}
+	})
+}
+
+// send queues records for every exporter and returns at once. done is
+// called once per exporter with the outcome of its delivery.
+func (f *fanoutExporter) send(ctx context.Context, records []CreateLogRequest, done func(sink int, err error)) {
+	for i, s := range f.sinks {
+		job := fanoutJob{ctx: ctx, records: records, done: func(err error) { done(i, err) }}
+		select {
+		case s.queue <- job:
+		default:
+			done(i, errSinkBacklog)
+		}
+	}
+}
+
+// drain waits for every queued batch to be delivered or given up on. No
+// batch may be sent afterwards.
+func (f *fanoutExporter) drain() {
+	for _, s := range f.sinks {
+		if s.queue != nil {
+			close(s.queue)
+		}
+	}
+	f.wg.Wait()
+}
+
+// Shutdown shuts every exporter down
+func (f *fanoutExporter) Shutdown(ctx context.Context) error {
+	var errs []error
+	for i, s := range f.sinks {
+		if err := s.exporter.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("kulascope: exporter %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,283 @@
+package kulascope
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/kulawise/kulascope-go-sdk/log"
+	"github.com/kulawise/kulascope-go-sdk/redact"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxStreamMessages caps how many messages per direction are kept for a stream
+const maxStreamMessages = 32
+
+// UnaryServerInterceptor returns an interceptor that captures every unary
+// call and queues it for delivery
+func (client *Client) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !client.captures(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		start := time.Now()
+		sc := client.grpcSpanContext(ctx)
+		if !client.cfg.DisableTraceResponseHeader {
+			grpc.SetHeader(ctx, client.traceHeader(sc))
+		}
+
+		ctx = client.newContext(ctx, sc)
+		resp, err := handler(ctx, req)
+
+		call := grpcCall{
+			span:       sc,
+			start:      start,
+			fullMethod: info.FullMethod,
+			err:        err,
+			requests:   []any{req},
+		}
+		if err == nil {
+			call.responses = []any{resp}
+		}
+		if client.finishGRPC(ctx, call) {
+			client.enqueue(client.newGRPCRecord(ctx, call))
+		}
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that captures every
+// streaming call and queues it for delivery once the stream ends
+func (client *Client) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !client.captures(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		start := time.Now()
+		sc := client.grpcSpanContext(ss.Context())
+		if !client.cfg.DisableTraceResponseHeader {
+			ss.SetHeader(client.traceHeader(sc))
+		}
+
+		ctx := client.newContext(ss.Context(), sc)
+		ws := &serverStream{ServerStream: ss, ctx: ctx}
+		err := handler(srv, ws)
+
+		call := grpcCall{
+			span:       sc,
+			start:      start,
+			fullMethod: info.FullMethod,
+			err:        err,
+			stream:     true,
+			requests:   ws.received,
+			responses:  ws.sent,
+			recvCount:  ws.recvCount,
+			sendCount:  ws.sendCount,
+		}
+		if client.finishGRPC(ctx, call) {
+			client.enqueue(client.newGRPCRecord(ctx, call))
+		}
+
+		return err
+	}
+}
+
+// serverStream swaps in the logging context and records the messages
+// flowing through the stream
+type serverStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	received  []any
+	sent      []any
+	recvCount int
+	sendCount int
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.recvCount++
+		if len(s.received) < maxStreamMessages {
+			s.received = append(s.received, cloneMessage(m))
+		}
+	}
+	return err
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sendCount++
+		if len(s.sent) < maxStreamMessages {
+			s.sent = append(s.sent, cloneMessage(m))
+		}
+	}
+	return err
+}
+
+// cloneMessage copies proto messages since handlers often reuse them
+func cloneMessage(m any) any {
+	if pm, ok := m.(proto.Message); ok {
+		return proto.Clone(pm)
+	}
+	return m
+}
+
+// grpcSpanContext extracts the trace context from incoming metadata
+func (client *Client) grpcSpanContext(ctx context.Context) spanContext {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return extractSpanContext(func(key string) string {
+		return first(md.Get(key))
+	})
+}
+
+// traceHeader is the response header metadata carrying the trace ID
+func (client *Client) traceHeader(sc spanContext) metadata.MD {
+	return metadata.Pairs(strings.ToLower(client.cfg.TraceResponseHeader), sc.traceID.String())
+}
+
+type grpcCall struct {
+	span       spanContext
+	start      time.Time
+	fullMethod string
+	err        error
+	stream     bool
+	requests   []any
+	responses  []any
+	recvCount  int
+	sendCount  int
+}
+
+// finishGRPC feeds a finished call into the route metrics, with the full
+// method as the route, and reports whether sampling keeps it
+func (client *Client) finishGRPC(ctx context.Context, call grpcCall) bool {
+	latency := time.Since(call.start)
+	client.observeRequest("GRPC", call.fullMethod, latency, grpcServerError(int(status.Code(call.err))))
+	return client.keep(finishedRequest{
+		route:   call.fullMethod,
+		traceID: call.span.traceID,
+		failed:  call.err != nil,
+		latency: latency,
+		subLogs: log.SubLogsFromContext(ctx),
+	})
+}
+
+// newGRPCRecord applies the client's redaction rules and builds the log payload
+func (client *Client) newGRPCRecord(ctx context.Context, call grpcCall) CreateLogRequest {
+	latency := int(time.Since(call.start).Milliseconds())
+	code := status.Code(call.err)
+	statusCode := int(code)
+	method := "GRPC"
+
+	var ip string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	reqMetadata := make(map[string][]string, len(md))
+	for k, v := range md {
+		reqMetadata[k] = append([]string(nil), v...)
+	}
+
+	meta := map[string]any{
+		"grpc_code":        code.String(),
+		"request_metadata": client.headerRules.Headers(reqMetadata),
+		"user_agent":       first(md.Get("user-agent")),
+		"content_type":     first(md.Get("content-type")),
+	}
+	if call.err != nil {
+		meta["error"] = status.Convert(call.err).Message()
+	}
+
+	reqLimit, respLimit := client.bodyLimits(client.policyFor(call.fullMethod))
+	if call.stream {
+		meta["stream"] = true
+		meta["request_messages"] = encodeMessages(meta, "request_messages", call.requests, client.requestRules, reqLimit)
+		meta["response_messages"] = encodeMessages(meta, "response_messages", call.responses, client.responseRules, respLimit)
+		meta["request_count"] = call.recvCount
+		meta["response_count"] = call.sendCount
+	} else {
+		meta["request_body"] = ""
+		meta["response_body"] = ""
+		if len(call.requests) > 0 {
+			meta["request_body"] = encodeMessage(meta, "request_body", call.requests[0], client.requestRules, reqLimit)
+		}
+		if len(call.responses) > 0 {
+			meta["response_body"] = encodeMessage(meta, "response_body", call.responses[0], client.responseRules, respLimit)
+		}
+	}
+
+	req := CreateLogRequest{
+		TraceID:   call.span.traceID,
+		Level:     "info",
+		Message:   "grpc call completed",
+		Status:    &statusCode,
+		Method:    &method,
+		Path:      &call.fullMethod,
+		Latency:   &latency,
+		IP:        &ip,
+		Metadata:  meta,
+		SubLogs:   scanSubLogs(log.SubLogsFromContext(ctx), client.requestRules),
+		Timestamp: time.Now(),
+	}
+	call.span.apply(&req)
+	return req
+}
+
+// encodeMessage renders a message as redacted JSON, using protojson for
+// proto messages so field names match the .proto definition. JSON longer
+// than limit is cut off and marked as truncated under key, the same way
+// HTTP bodies are.
+func encodeMessage(meta map[string]any, key string, m any, rules redact.Redactor, limit int) string {
+	if m == nil {
+		return ""
+	}
+	var b []byte
+	var err error
+	if pm, ok := m.(proto.Message); ok {
+		b, err = protojson.Marshal(pm)
+	} else {
+		b, err = json.Marshal(m)
+	}
+	if err != nil {
+		return ""
+	}
+	b, truncated := capBody(b, limit)
+	if truncated {
+		meta[key+"_truncated"] = true
+	}
+	return string(rules.JSON(b))
+}
+
+// encodeMessages applies encodeMessage to each message, with limit per
+// message
+func encodeMessages(meta map[string]any, key string, ms []any, rules redact.Redactor, limit int) []string {
+	out := make([]string, 0, len(ms))
+	for _, m := range ms {
+		out = append(out, encodeMessage(meta, key, m, rules, limit))
+	}
+	return out
+}
+
+func first(vals []string) string {
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0]
+}
@@ -0,0 +1,149 @@
+package kulascope
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// healthServer answers Check with SERVING, or NotFound for "missing", and
+// streams watchCount updates from Watch
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+	watchCount int
+}
+
+func (s *healthServer) Check(_ context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if req.Service == "missing" {
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *healthServer) Watch(_ *healthpb.HealthCheckRequest, stream grpc.ServerStreamingServer[healthpb.HealthCheckResponse]) error {
+	for range s.watchCount {
+		if err := stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newGRPCTestServer serves srv over an in-memory connection behind the
+// client's interceptors
+func newGRPCTestServer(t *testing.T, client *Client, srv healthpb.HealthServer) healthpb.HealthClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(client.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(client.StreamServerInterceptor()),
+	)
+	healthpb.RegisterHealthServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestGRPCUnary(t *testing.T) {
+	client, flush := newTestClient(t, Config{MaxRequestBodyBytes: 16})
+	health := newGRPCTestServer(t, client, &healthServer{})
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"authorization", "Bearer s3cret",
+		"traceparent", "00-"+testTraceID+"-"+testSpanID+"-01",
+	)
+	var header metadata.MD
+	if _, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: "orders.v1.OrderService"}, grpc.Header(&header)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Check(missing) = %v, want NotFound", err)
+	}
+
+	wantTrace := uuid.MustParse(testTraceID).String()
+	if got := first(header.Get("x-trace-id")); got != wantTrace {
+		t.Errorf("trace response header %q, want %q", got, wantTrace)
+	}
+
+	records := flush()
+	if len(records) != 2 {
+		t.Fatalf("captured %d records, want 2", len(records))
+	}
+	ok, notFound := records[0], records[1]
+	if fmt.Sprint(ok.Metadata["request_body"]) == fmt.Sprint(notFound.Metadata["request_body"]) {
+		ok, notFound = notFound, ok
+	}
+
+	if ok.TraceID.String() != wantTrace || ok.ParentSpanID == nil || *ok.ParentSpanID != testSpanID {
+		t.Errorf("trace %s, parent %v; want the caller's traceparent", ok.TraceID, ok.ParentSpanID)
+	}
+	if *ok.Status != int(codes.OK) || ok.Metadata["grpc_code"] != "OK" {
+		t.Errorf("status %d %v, want 0 OK", *ok.Status, ok.Metadata["grpc_code"])
+	}
+	if md := fmt.Sprint(ok.Metadata["request_metadata"]); strings.Contains(md, "s3cret") || !strings.Contains(md, "authorization") {
+		t.Errorf("request metadata %s, want authorization redacted", md)
+	}
+	if ok.Metadata["request_body_truncated"] != true || !strings.HasPrefix(fmt.Sprint(ok.Metadata["request_body"]), `{"service":"orde`) {
+		t.Errorf("request body %v, want it cut at 16 bytes", ok.Metadata["request_body"])
+	}
+	if ok.Metadata["response_body"] != `{"status":"SERVING"}` {
+		t.Errorf("response body %v", ok.Metadata["response_body"])
+	}
+
+	if *notFound.Status != int(codes.NotFound) || notFound.Metadata["grpc_code"] != "NotFound" || notFound.Metadata["error"] != "unknown service" {
+		t.Errorf("failed call recorded as %d %v %v", *notFound.Status, notFound.Metadata["grpc_code"], notFound.Metadata["error"])
+	}
+}
+
+func TestGRPCStreamMessageCap(t *testing.T) {
+	client, flush := newTestClient(t, Config{})
+	health := newGRPCTestServer(t, client, &healthServer{watchCount: maxStreamMessages + 8})
+
+	stream, err := health.Watch(context.Background(), &healthpb.HealthCheckRequest{Service: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := 0
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+		received++
+	}
+	if received != maxStreamMessages+8 {
+		t.Fatalf("client received %d messages, want %d", received, maxStreamMessages+8)
+	}
+
+	records := flush()
+	if len(records) != 1 {
+		t.Fatalf("captured %d records, want 1", len(records))
+	}
+	meta := records[0].Metadata
+	if msgs, _ := meta["response_messages"].([]any); len(msgs) != maxStreamMessages {
+		t.Errorf("kept %d response messages, want %d", len(msgs), maxStreamMessages)
+	}
+	if meta["response_count"] != float64(maxStreamMessages+8) || meta["request_count"] != float64(1) {
+		t.Errorf("counted %v responses and %v requests", meta["response_count"], meta["request_count"])
+	}
+}
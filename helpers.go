@@ -1,10 +1,10 @@
 package kulascope
 
 import (
-	"encoding/json"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/kulawise/kulascope-go-sdk/redact"
 )
 
 // find checks case-insensitive membership
@@ -17,72 +17,23 @@ func find(haystack []string, needle string) bool {
 	return false
 }
 
-// RedactJSON walks through the JSON object and replaces values of sensitive keys
+// RedactJSON walks through the JSON object and replaces values of sensitive
+// keys. Entries starting with $ are path expressions such as $.users[*].ssn;
+// invalid paths are ignored here but rejected by New.
 func RedactJSON(data []byte, redactList []string) []byte {
-	if len(data) == 0 {
-		return data
-	}
-
-	var src interface{}
-	if err := json.Unmarshal(data, &src); err != nil {
-		// if not JSON, return as-is
-		return data
-	}
-
-	RedactRecursive(src, redactList)
-
-	out, err := json.Marshal(src)
-	if err != nil {
-		return data
-	}
-	return out
+	return redact.Lenient(redact.Options{Rules: redactList}).JSON(data)
 }
 
-// helper: recursively walk JSON object
-func RedactRecursive(node interface{}, redactList []string) {
-	switch v := node.(type) {
-	case map[string]interface{}:
-		for key, val := range v {
-			// if the key matches the redact rules, replace the value
-			if keyMatchesRedact(key, redactList) {
-				v[key] = "[CLIENT_REDACTED]"
-				continue
-			}
-
-			// If the value is a string that *looks like* JSON, try to parse and redact inside it
-			if s, ok := val.(string); ok {
-				ts := strings.TrimSpace(s)
-				if len(ts) > 0 && (ts[0] == '{' || ts[0] == '[') {
-					var nested interface{}
-					if err := json.Unmarshal([]byte(ts), &nested); err == nil {
-						RedactRecursive(nested, redactList)
-						if b, err := json.Marshal(nested); err == nil {
-							v[key] = string(b)
-							continue
-						}
-					}
-				}
-			}
-
-			// Otherwise recurse normally
-			RedactRecursive(val, redactList)
-		}
-
-	case []interface{}:
-		for i := range v {
-			RedactRecursive(v[i], redactList)
-		}
-	}
+// RedactBody is RedactJSON for any body, picking the format from its
+// content type: url-encoded and multipart forms, XML, plain-text
+// key=value pairs or JSON
+func RedactBody(data []byte, contentType string, redactList []string) []byte {
+	return redact.Lenient(redact.Options{Rules: redactList}).Body(data, contentType)
 }
 
-// RedactHeaders replaces sensitive headers with "[CLIENT_REDACTED]"
-func redactHeaders(headers map[string][]string, redactList []string) map[string][]string {
-	for k := range headers {
-		if keyMatchesRedact(k, redactList) {
-			headers[k] = []string{"[CLIENT_REDACTED]"}
-		}
-	}
-	return headers
+// RedactRecursive redacts a decoded JSON value in place
+func RedactRecursive(node interface{}, redactList []string) {
+	redact.Lenient(redact.Options{Rules: redactList}).Value(node)
 }
 
 type responseWriterWrapper struct {
@@ -105,11 +56,16 @@ func WrapResponseWriter(c *fiber.Ctx) *responseWriterWrapper {
 	return &responseWriterWrapper{Ctx: c, size: 0}
 }
 
+// mergeRedactKeys combines default and custom rules, dropping duplicates.
+// Key names are lowercased; path expressions keep their case.
 func mergeRedactKeys(defaults, custom []string) []string {
 	seen := make(map[string]struct{})
 	out := make([]string, 0, len(defaults)+len(custom))
 	for _, k := range append(defaults, custom...) {
-		s := strings.ToLower(strings.TrimSpace(k))
+		s := strings.TrimSpace(k)
+		if !redact.IsPath(s) {
+			s = strings.ToLower(s)
+		}
 		if s == "" {
 			continue
 		}
@@ -120,17 +76,3 @@ func mergeRedactKeys(defaults, custom []string) []string {
 	}
 	return out
 }
-
-func keyMatchesRedact(key string, redactList []string) bool {
-	keyLower := strings.ToLower(strings.TrimSpace(key))
-	for _, r := range redactList {
-		if r == "" {
-			continue
-		}
-		// redactList entries are expected to be lowercased (see mergeRedactKeys)
-		if keyLower == r || strings.Contains(keyLower, r) || strings.Contains(r, keyLower) {
-			return true
-		}
-	}
-	return false
-}
@@ -0,0 +1,305 @@
+package kulascope
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kulawise/kulascope-go-sdk/log"
+)
+
+// HTTPMiddleware creates a client from cfg, makes it the default and returns
+// its net/http middleware, usable directly with chi's Use. It panics if cfg
+// is invalid; use New to handle the error.
+func HTTPMiddleware(cfg Config) func(http.Handler) http.Handler {
+	client, err := New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	setDefault(client)
+	return client.Handler
+}
+
+// Handler wraps next so that every request is captured and queued for
+// delivery, the same way the Fiber Middleware does
+func (client *Client) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !client.captures(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		policy := client.policyFor(r.URL.Path)
+		sc := extractSpanContext(r.Header.Get)
+		if !client.cfg.DisableTraceResponseHeader {
+			w.Header().Set(client.cfg.TraceResponseHeader, sc.traceID.String())
+		}
+
+		reqLimit, respLimit := client.bodyLimits(policy)
+		var (
+			reqBody []byte
+			reqRest *countingReader // set when the body is longer than reqLimit
+		)
+		if r.Body != nil && r.Body != http.NoBody {
+			src := io.Reader(r.Body)
+			if reqLimit >= 0 {
+				src = io.LimitReader(r.Body, int64(reqLimit)+1)
+			}
+			reqBody, _ = io.ReadAll(src)
+			if reqLimit >= 0 && len(reqBody) > reqLimit {
+				// hand the handler what was read followed by the rest,
+				// and keep only the prefix
+				reqRest = &countingReader{r: r.Body}
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(reqBody), reqRest), r.Body}
+			} else {
+				r.Body.Close()
+				r.Body = io.NopCloser(bytes.NewReader(reqBody))
+			}
+		}
+
+		reqHeaders := cloneHeaders(r.Header)
+		if r.Host != "" {
+			reqHeaders["Host"] = []string{r.Host}
+		}
+
+		ctx := client.newContext(r.Context(), sc)
+		r = r.WithContext(ctx)
+
+		rw := &httpResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		rw.body.limit = respLimit
+		if policy != nil && (policy.HeadersOnly || policy.NoResponseBody) {
+			rw.skipBody = true
+		}
+		next.ServeHTTP(rw, r)
+
+		route := client.httpRoute(r)
+		client.observeRequest(r.Method, route, time.Since(start), rw.status >= 500)
+
+		subLogs := log.SubLogsFromContext(ctx)
+		if !client.keep(finishedRequest{
+			route:   route,
+			traceID: sc.traceID,
+			failed:  rw.status >= 500,
+			latency: time.Since(start),
+			subLogs: subLogs,
+		}) {
+			return
+		}
+
+		reqSize := len(reqBody)
+		if reqRest != nil {
+			reqSize += int(reqRest.n)
+			if int64(reqSize) < r.ContentLength {
+				// the handler stopped reading early
+				reqSize = int(r.ContentLength)
+			}
+			reqBody = reqBody[:reqLimit]
+		}
+
+		client.enqueue(client.newRecord(capturedRequest{
+			span:              sc,
+			start:             start,
+			method:            r.Method,
+			path:              r.URL.Path,
+			query:             r.URL.RawQuery,
+			route:             route,
+			params:            client.httpParams(r),
+			policy:            policy,
+			ip:                remoteIP(r),
+			status:            rw.status,
+			userAgent:         r.UserAgent(),
+			referer:           r.Referer(),
+			host:              r.Host,
+			contentType:       r.Header.Get("Content-Type"),
+			requestHeaders:    reqHeaders,
+			requestBody:       reqBody,
+			requestSize:       reqSize,
+			requestTruncated:  reqRest != nil,
+			responseHeaders:   cloneHeaders(rw.Header()),
+			responseType:      rw.Header().Get("Content-Type"),
+			responseBody:      rw.body.Bytes(),
+			responseSize:      rw.size,
+			responseTruncated: rw.body.truncated,
+			subLogs:           subLogs,
+		}))
+	})
+}
+
+func cloneHeaders(h http.Header) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for k, v := range h {
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
+
+// remoteIP strips the port from RemoteAddr, matching Fiber's c.IP()
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// httpResponseWriter records the status, size and body written by a handler
+// while passing everything through to the underlying writer
+type httpResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	body        bodyBuffer
+	skipBody    bool // the route policy drops the response body
+	wroteHeader bool
+}
+
+// WriteHeader records the first final status. Informational 1xx responses
+// such as 103 Early Hints are passed through without being recorded.
+func (w *httpResponseWriter) WriteHeader(status int) {
+	informational := status >= 100 && status < 200 && status != http.StatusSwitchingProtocols
+	if !w.wroteHeader && !informational {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *httpResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	if !w.skipBody {
+		w.body.Write(b[:n])
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher
+func (w *httpResponseWriter) Flush() {
+	w.wroteHeader = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker. Once hijacked, the connection is no
+// longer observed; the status is recorded as 101 Switching Protocols.
+func (w *httpResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("kulascope: underlying ResponseWriter does not implement http.Hijacker")
+	}
+	if !w.wroteHeader {
+		w.status = http.StatusSwitchingProtocols
+		w.wroteHeader = true
+	}
+	return h.Hijack()
+}
+
+// ReadFrom implements io.ReaderFrom so io.Copy keeps using the underlying
+// writer's fast path while the body is still captured
+func (w *httpResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.wroteHeader = true
+	tee := r
+	if !w.skipBody {
+		tee = io.TeeReader(r, &w.body)
+	}
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(tee)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, tee)
+	}
+	w.size += int(n)
+	return n, err
+}
+
+// bodyBuffer keeps the first limit bytes written to it, or everything
+// when limit is negative, and drops the rest
+type bodyBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *bodyBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.limit >= 0 && b.Len()+len(p) > b.limit {
+		p = p[:b.limit-b.Len()]
+		b.truncated = true
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *httpResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// httpRoute returns the route template of a net/http request: Config's
+// RoutePattern when it has one, otherwise the ServeMux pattern without
+// its method
+func (c *Client) httpRoute(r *http.Request) string {
+	if c.cfg.RoutePattern != nil {
+		if route := c.cfg.RoutePattern(r); route != "" {
+			return route
+		}
+	}
+	route := r.Pattern
+	if i := strings.IndexByte(route, ' '); i >= 0 {
+		route = strings.TrimLeft(route[i:], " ")
+	}
+	return route
+}
+
+// httpParams returns the path parameters of a net/http request: Config's
+// RouteParams when set, otherwise the wildcards of the ServeMux pattern
+func (c *Client) httpParams(r *http.Request) map[string]string {
+	if c.cfg.RouteParams != nil {
+		return c.cfg.RouteParams(r)
+	}
+	var params map[string]string
+	for rest := r.Pattern; ; {
+		_, after, ok := strings.Cut(rest, "{")
+		if !ok {
+			return params
+		}
+		name, tail, ok := strings.Cut(after, "}")
+		if !ok {
+			return params
+		}
+		rest = tail
+		name = strings.TrimSuffix(name, "...")
+		if name == "" || name == "$" {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = r.PathValue(name)
+	}
+}
@@ -0,0 +1,196 @@
+package kulascope
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHandlerRecordsResponse(t *testing.T) {
+	client, flush := newTestClient(t, Config{MaxResponseBodyBytes: 8})
+	handler := client.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</app.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created order 42")
+	}))
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/orders", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || string(body) != "created order 42" {
+		t.Fatalf("client got %d %q", resp.StatusCode, body)
+	}
+
+	records := flush()
+	if len(records) != 1 {
+		t.Fatalf("captured %d records, want 1", len(records))
+	}
+	r := records[0]
+	if *r.Status != http.StatusCreated {
+		t.Errorf("recorded status %d, want 201", *r.Status)
+	}
+	if body := r.Metadata["response_body"]; body != "created " {
+		t.Errorf("recorded body %q, want the first 8 bytes", body)
+	}
+	if r.Metadata["response_body_truncated"] != true {
+		t.Error("body over the limit not marked truncated")
+	}
+	if size := r.Metadata["response_size"]; size != float64(len("created order 42")) {
+		t.Errorf("recorded size %v, want the full length", size)
+	}
+}
+
+func TestHTTPHandlerFlusher(t *testing.T) {
+	client, flush := newTestClient(t, Config{})
+	handler := client.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "chunk")
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("wrapped writer is not an http.Flusher")
+		}
+		f.Flush()
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if !rec.Flushed {
+		t.Error("Flush did not reach the underlying writer")
+	}
+	if records := flush(); len(records) != 1 || records[0].Metadata["response_body"] != "chunk" {
+		t.Errorf("records %+v, want one with the streamed body", records)
+	}
+}
+
+func TestHTTPHandlerHijacker(t *testing.T) {
+	client, flush := newTestClient(t, Config{})
+	srv := httptest.NewServer(client.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		buf.Flush()
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hijacked" {
+		t.Fatalf("client got %q", body)
+	}
+
+	records := flush()
+	if len(records) != 1 || *records[0].Status != http.StatusSwitchingProtocols {
+		t.Fatalf("records %+v, want one with status 101", records)
+	}
+}
+
+func TestHTTPHandlerHijackUnsupported(t *testing.T) {
+	client, _ := newTestClient(t, Config{})
+	var err error
+	handler := client.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, err = w.(http.Hijacker).Hijack()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if err == nil || !strings.Contains(err.Error(), "http.Hijacker") {
+		t.Errorf("Hijack on a recorder returned %v", err)
+	}
+}
+
+func TestHTTPRouteFromServeMux(t *testing.T) {
+	client, flush := newTestClient(t, Config{})
+	mux := http.NewServeMux()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	mux.HandleFunc("GET /orders/{id}", ok)
+	mux.HandleFunc("/files/{path...}", ok)
+	mux.HandleFunc("POST /users/{uid}/keys/{kid}", ok)
+	mux.HandleFunc("/{$}", ok)
+	handler := client.Handler(mux)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/orders/42", nil),
+		httptest.NewRequest(http.MethodPut, "/files/a/b.txt", nil),
+		httptest.NewRequest(http.MethodPost, "/users/7/keys/k1", nil),
+		httptest.NewRequest(http.MethodGet, "/", nil),
+		httptest.NewRequest(http.MethodGet, "/nowhere", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	type capture struct {
+		route  string
+		params string
+	}
+	got := make(map[string]capture)
+	for _, r := range flush() {
+		var route string
+		if r.Route != nil {
+			route = *r.Route
+		}
+		got[*r.Path] = capture{route, fmt.Sprint(r.Metadata["path_params"])}
+	}
+	for path, want := range map[string]capture{
+		"/orders/42":       {"/orders/{id}", "map[id:42]"},
+		"/files/a/b.txt":   {"/files/{path...}", "map[path:a/b.txt]"},
+		"/users/7/keys/k1": {"/users/{uid}/keys/{kid}", "map[kid:k1 uid:7]"},
+		"/":                {"/{$}", "<nil>"},
+		"/nowhere":         {"", "<nil>"},
+	} {
+		if got[path] != want {
+			t.Errorf("%s: recorded %+v, want %+v", path, got[path], want)
+		}
+	}
+}
+
+func TestHTTPRouteHooks(t *testing.T) {
+	client, flush := newTestClient(t, Config{
+		RoutePattern: func(r *http.Request) string {
+			if r.Header.Get("X-Route") == "" {
+				return ""
+			}
+			return "/v1/orders/:id"
+		},
+		RouteParams: func(r *http.Request) map[string]string {
+			return map[string]string{"id": strings.TrimPrefix(r.URL.Path, "/v1/orders/")}
+		},
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	handler := client.Handler(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/orders/9", nil)
+	req.Header.Set("X-Route", "1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders/10", nil))
+
+	routes := make(map[string]string)
+	for _, r := range flush() {
+		routes[*r.Path] = *r.Route
+		if id := r.Metadata["path_params"].(map[string]any)["id"]; id != strings.TrimPrefix(*r.Path, "/v1/orders/") {
+			t.Errorf("%s: RouteParams gave id %v", *r.Path, id)
+		}
+	}
+	if routes["/v1/orders/9"] != "/v1/orders/:id" {
+		t.Errorf("RoutePattern not used: %q", routes["/v1/orders/9"])
+	}
+	if routes["/v1/orders/10"] != "/v1/orders/{id}" {
+		t.Errorf("empty RoutePattern did not fall back to the mux pattern: %q", routes["/v1/orders/10"])
+	}
+}
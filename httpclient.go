@@ -0,0 +1,87 @@
+package kulascope
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// newHTTPClient builds the client used to reach the ingest API from the
+// config's HTTPClient, Transport, proxy and TLS settings
+func newHTTPClient(cfg Config) (*http.Client, error) {
+	custom := cfg.ProxyURL != "" || cfg.CAFile != "" || cfg.ClientCertFile != "" || cfg.ClientKeyFile != ""
+	if custom && (cfg.HTTPClient != nil || cfg.Transport != nil) {
+		return nil, errors.New("kulascope: ProxyURL, CAFile and client certificates cannot be combined with HTTPClient or Transport")
+	}
+	if cfg.HTTPClient != nil {
+		return cfg.HTTPClient, nil
+	}
+	if cfg.Transport != nil {
+		return &http.Client{Transport: cfg.Transport}, nil
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("kulascope: invalid ProxyURL: %w", err)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	if cfg.CAFile != "" || cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		tlsCfg, err := loadTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig = tlsCfg
+	}
+	return &http.Client{Transport: t}, nil
+}
+
+// loadTLSConfig reads the CA bundle and the mTLS key pair
+func loadTLSConfig(cfg Config) (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("kulascope: read CAFile: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kulascope: no certificates found in %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		if cfg.ClientCertFile == "" || cfg.ClientKeyFile == "" {
+			return nil, errors.New("kulascope: ClientCertFile and ClientKeyFile must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("kulascope: load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// ingestEndpoint returns the URL batches are posted to: BaseURL when set,
+// otherwise the API for the environment
+func ingestEndpoint(cfg Config) (string, error) {
+	if cfg.BaseURL == "" {
+		return ingestURL(cfg.Environment), nil
+	}
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("kulascope: invalid BaseURL %q", cfg.BaseURL)
+	}
+	return strings.TrimRight(cfg.BaseURL, "/") + "/kulascope/logs", nil
+}
@@ -0,0 +1,134 @@
+package kulascope
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIngestEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  Config
+		want string // empty for an error
+	}{
+		{Config{}, "https://api.kulawise.com/kulascope/logs"},
+		{Config{Environment: Staging}, "https://api.staging.kulawise.com/kulascope/logs"},
+		{Config{BaseURL: "http://localhost:8080"}, "http://localhost:8080/kulascope/logs"},
+		{Config{BaseURL: "https://ingest.example.com/"}, "https://ingest.example.com/kulascope/logs"},
+		{Config{BaseURL: "ingest.example.com"}, ""},
+		{Config{BaseURL: "/kulascope"}, ""},
+		{Config{BaseURL: "http://"}, ""},
+		{Config{BaseURL: "http://bad host"}, ""},
+	} {
+		got, err := ingestEndpoint(tc.cfg)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("BaseURL %q: got %q, want an error", tc.cfg.BaseURL, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("BaseURL %q: got %q, %v; want %q", tc.cfg.BaseURL, got, err, tc.want)
+		}
+	}
+
+	if _, err := New(Config{APIKey: "test", BaseURL: "ingest.example.com"}); err == nil {
+		t.Error("New accepted an invalid BaseURL")
+	}
+}
+
+func TestHTTPClientConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, cfg := range map[string]Config{
+		"proxy with transport": {ProxyURL: "http://proxy:3128", Transport: http.DefaultTransport},
+		"CA with client":       {CAFile: empty, HTTPClient: http.DefaultClient},
+		"bad proxy":            {ProxyURL: "http://bad host"},
+		"missing CA file":      {CAFile: filepath.Join(dir, "missing.pem")},
+		"no certificates":      {CAFile: empty},
+		"cert without key":     {ClientCertFile: empty},
+	} {
+		if _, err := newHTTPClient(cfg); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+// ingestRecorder counts the batches an ingest server or proxy receives
+type ingestRecorder struct {
+	mu    sync.Mutex
+	hosts []string
+	paths []string
+}
+
+func (r *ingestRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts = append(r.hosts, req.Host)
+	r.paths = append(r.paths, req.URL.Path)
+}
+
+func (r *ingestRecorder) requests() ([]string, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hosts, r.paths
+}
+
+func sendOne(t *testing.T, cfg Config) (int, error) {
+	t.Helper()
+	cfg.APIKey = "test"
+	cfg.DisableBreaker = true
+	cfg.Retry = RetryPolicy{MaxRetries: -1}
+	client, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown(context.Background())
+	client.enqueue(CreateLogRequest{Level: "info", Message: "m", Timestamp: time.Now()})
+	return client.Flush(context.Background())
+}
+
+func TestHTTPClientCAFile(t *testing.T) {
+	rec := &ingestRecorder{}
+	srv := httptest.NewTLSServer(rec)
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := sendOne(t, Config{BaseURL: srv.URL}); n != 1 || err != nil {
+		t.Fatalf("without CAFile: Flush = %d, %v; want the batch to fail", n, err)
+	}
+	if n, err := sendOne(t, Config{BaseURL: srv.URL, CAFile: caFile}); n != 0 || err != nil {
+		t.Fatalf("with CAFile: Flush = %d, %v", n, err)
+	}
+	if _, paths := rec.requests(); len(paths) != 1 || paths[0] != "/kulascope/logs" {
+		t.Fatalf("server got %v, want one batch", paths)
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	proxy := &ingestRecorder{}
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+
+	if n, err := sendOne(t, Config{BaseURL: "http://ingest.invalid", ProxyURL: srv.URL}); n != 0 || err != nil {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	hosts, paths := proxy.requests()
+	if len(hosts) != 1 || hosts[0] != "ingest.invalid" || paths[0] != "/kulascope/logs" {
+		t.Fatalf("proxy got hosts %v and paths %v, want one batch for ingest.invalid", hosts, paths)
+	}
+}
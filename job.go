@@ -1,85 +1,266 @@
 package kulascope
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"sync"
 	"time"
 )
 
 type sendJob struct {
-	cfg     Config
 	payload CreateLogRequest
+	body    []byte   // pre-encoded payload, set for spooled and replayed jobs
+	seg     *segment // spool segment holding the record, if any
+	frame   int      // the record's frame index in seg
 }
 
-var sendQueue chan sendJob
+// enqueue writes the record to the spool, when enabled, and queues it for
+// delivery, applying the overflow policy when the queue is full. Records
+// are dropped once Shutdown has been called.
+func (c *Client) enqueue(payload CreateLogRequest) {
+	c.enqueueWith(payload, c.cfg.QueueOverflow)
+}
+
+// enqueueWith is enqueue with the given overflow policy. It reports false
+// if the record was refused because Shutdown has been called.
+func (c *Client) enqueueWith(payload CreateLogRequest, overflow OverflowPolicy) bool {
+	c.acceptMu.RLock()
+	defer c.acceptMu.RUnlock()
+	if !c.accepting.Load() {
+		c.failed.Add(1)
+		return false
+	}
+
+	job := sendJob{payload: payload}
+
+	if c.spool != nil {
+		body, err := json.Marshal(payload)
+		if err == nil {
+			job.body = body
+			job.seg, job.frame, err = c.spool.append(body)
+		}
+		if err != nil {
+			c.logger.Error().Err(err).Msg("failed to spool log")
+		}
+	}
+
+	c.pending.Add(1)
+	select {
+	case c.sendQueue <- job:
+		return true
+	default:
+		return c.overflowJob(job, overflow)
+	}
+}
+
+// replaySpool queues records left over from a previous process. New has
+// already counted them as pending.
+func (c *Client) replaySpool(batches []replayBatch) {
+	defer c.senderWG.Done()
 
-func startSenderWorkers(num int) {
-	sendQueue = make(chan sendJob, 50_000)
-	for i := 0; i < num; i++ {
-		go senderWorker()
+	left := 0
+	for _, rb := range batches {
+		left += len(rb.bodies)
+	}
+	for _, rb := range batches {
+		for i, body := range rb.bodies {
+			var payload CreateLogRequest
+			if err := json.Unmarshal(body, &payload); err != nil {
+				c.logger.Error().Err(err).Msg("failed to decode spooled log")
+				c.pending.Add(-1)
+				c.failed.Add(1)
+				c.spool.ack(rb.seg, rb.frames[i])
+				left--
+				continue
+			}
+			select {
+			case c.sendQueue <- sendJob{payload: payload, body: body, seg: rb.seg, frame: rb.frames[i]}:
+				left--
+			case <-c.stopSenders:
+				// still on disk, picked up again on the next start
+				c.pending.Add(-int64(left))
+				return
+			}
+		}
 	}
 }
 
-func senderWorker() {
-	for job := range sendQueue {
-		sendWithRetry(job)
+func (c *Client) startSenderWorkers() {
+	for i := 0; i < c.cfg.WorkerCount; i++ {
+		sig := make(chan struct{}, 1)
+		c.flushSignals = append(c.flushSignals, sig)
+		c.senderWG.Add(1)
+		go c.senderWorker(sig)
 	}
 }
 
-func sendWithRetry(job sendJob) {
-	const maxRetries = 5
+// senderWorker groups queued payloads into batches bounded by record count,
+// body size and BatchInterval, and sends each batch as one request. On
+// Shutdown it drains whatever is left in the queue before exiting.
+func (c *Client) senderWorker(flushSignal <-chan struct{}) {
+	defer c.senderWG.Done()
 
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		err := trySend(job.cfg, job.payload)
-		if err == nil {
+	cfg := c.cfg
+
+	var b batch
+	ticker := time.NewTicker(cfg.BatchInterval)
+	defer ticker.Stop()
+
+	flushBatch := func() {
+		if b.len() == 0 {
 			return
 		}
-
-		if attempt == maxRetries {
-			baseLogger.Error().Err(err).Msg("failed to send log after retries")
+		if c.fanout != nil {
+			c.sendFanout(b.detach())
 			return
 		}
+		c.sendWithRetry(&b)
+		c.pending.Add(-int64(b.len()))
+		b.reset()
+	}
+
+	addJob := func(job sendJob) {
+		body := job.body
+		if body == nil {
+			var err error
+			if body, err = json.Marshal(job.payload); err != nil {
+				c.logger.Error().Err(err).Msg("failed to encode log")
+				c.pending.Add(-1)
+				c.failed.Add(1)
+				return
+			}
+		}
 
-		wait := time.Duration(1<<attempt) * time.Second
-		time.Sleep(wait)
+		if !b.fits(body, cfg.BatchMaxRecords, cfg.BatchMaxBytes) {
+			flushBatch()
+		}
+		b.add(job.payload, body, job.seg, job.frame)
+		if b.len() >= cfg.BatchMaxRecords || b.size >= cfg.BatchMaxBytes {
+			flushBatch()
+		}
 	}
-}
 
-func trySend(cfg Config, payload CreateLogRequest) error {
-	b, err := json.Marshal(payload)
-	if err != nil {
-		return err
+	for {
+		select {
+		case job := <-c.sendQueue:
+			addJob(job)
+		case <-ticker.C:
+			flushBatch()
+		case <-flushSignal:
+			flushBatch()
+		case <-c.stopSenders:
+			for {
+				select {
+				case job := <-c.sendQueue:
+					addJob(job)
+				default:
+					flushBatch()
+					return
+				}
+			}
+		}
 	}
+}
 
-	if cfg.APIKey == "" {
-		return nil
+// sendWithRetry exports the batch, retrying the same set of records per
+// the retry policy. A batch that is rejected or runs out of retries goes
+// to the dead-letter sink. Spooled records are only acknowledged once the
+// batch is accepted by either; otherwise they wait for replay.
+func (c *Client) sendWithRetry(b *batch) {
+	r := retrier{policy: c.cfg.Retry, breaker: c.breaker, stats: &c.exports}
+	err := r.export(c.ctx, c.exporter, b.records)
+	if err == nil {
+		c.delivered.Add(int64(b.len()))
+		c.batches.Add(1)
+		c.bytesSent.Add(int64(b.size))
+		b.ack(c.spool)
+		return
 	}
+	_, failed := undelivered(b.records, err)
+	c.delivered.Add(int64(b.len() - failed))
+	c.failed.Add(int64(failed))
+	if c.giveUp(b.records, err) {
+		b.ack(c.spool)
+	}
+}
+
+// sendFanout hands the batch to every exporter behind the fan-out and
+// returns at once. Each exporter that gives up on the batch dead-letters
+// it for itself. Spooled records are acknowledged once every exporter has
+// delivered or dead-lettered them.
+func (c *Client) sendFanout(b *batch) {
+	var (
+		mu     sync.Mutex
+		left   = len(c.fanout.sinks)
+		failed bool
+		keep   bool // an exporter still needs the records from the spool
+	)
+	c.fanout.send(c.ctx, b.records, func(sink int, err error) {
+		if err != nil {
+			err = fmt.Errorf("kulascope: exporter %d: %w", sink, err)
+		}
+		kept := err != nil && !c.giveUp(b.records, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		failed = failed || err != nil
+		keep = keep || kept
+		if left--; left > 0 {
+			return
+		}
+		if failed {
+			c.failed.Add(int64(b.len()))
+		} else {
+			c.delivered.Add(int64(b.len()))
+			c.batches.Add(1)
+			c.bytesSent.Add(int64(b.size))
+		}
+		if !keep {
+			b.ack(c.spool)
+		}
+		c.pending.Add(-int64(b.len()))
+	})
+}
 
-	var url string
-	if cfg.Environment == Staging {
-		url = "https://api.staging.kulawise.com/kulascope/logs"
+// giveUp logs a batch that could not be delivered and hands the records
+// that were not delivered to the dead-letter sink. It reports whether the
+// sink took them, so that spooled records may be acknowledged.
+func (c *Client) giveUp(records []CreateLogRequest, err error) bool {
+	if c.ctx.Err() != nil && c.spool != nil {
+		// aborted by Shutdown, replayed from the spool on the next start
+		return false
+	}
+	records, failed := undelivered(records, err)
+	if ok, _ := retryable(err); !ok {
+		c.rejected.Add(1)
+		c.lastRejection.Store(&err)
+		c.logger.Error().Err(err).Int("records", failed).Msg("log batch rejected")
 	} else {
-		url = "https://api.kulawise.com/kulascope/logs"
+		c.logger.Error().Err(err).Int("records", failed).Msg("failed to send log batch after retries")
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(b))
-	if err != nil {
-		return err
+	if len(records) == 0 {
+		// the rest was delivered, and a replay would send it again
+		return true
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", cfg.APIKey)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	if c.cfg.DeadLetter == nil {
+		return false
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 500 {
-		return fmt.Errorf("server error: %d", resp.StatusCode)
+	if dlErr := c.cfg.DeadLetter.WriteDeadLetter(records, err); dlErr != nil {
+		c.logger.Error().Err(dlErr).Int("records", len(records)).Msg("failed to write dead letters")
+		return false
 	}
+	c.deadLettered.Add(int64(len(records)))
+	return true
+}
 
-	return nil
+// rejectionSince returns an error for batches rejected after the count was
+// n, or nil
+func (c *Client) rejectionSince(n int64) error {
+	now := c.rejected.Load()
+	if now == n {
+		return nil
+	}
+	last := c.lastRejection.Load()
+	return fmt.Errorf("kulascope: batches rejected (%d): %w", now-n, *last)
 }
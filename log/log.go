@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/kulawise/kulascope-go-sdk/redact"
 	"github.com/rs/zerolog"
 )
 
@@ -30,11 +31,12 @@ type SubLogRequest struct {
 
 // EventLogger is the per-request logger
 type EventLogger struct {
-	ctx     context.Context
-	zlog    *zerolog.Logger
-	mu      sync.Mutex
-	logs    []SubLogRequest
-	traceID uuid.UUID
+	ctx      context.Context
+	zlog     *zerolog.Logger
+	mu       sync.Mutex
+	logs     []SubLogRequest
+	traceID  uuid.UUID
+	redactor redact.Redactor
 }
 
 // NewEventLogger creates a new EventLogger for a request
@@ -65,6 +67,19 @@ func FromContext(ctx context.Context) *EventLogger {
 	return NewEventLogger(ctx, &nop, uuid.Nil)
 }
 
+// SetRedactor sets the rules applied to sub-log metadata. By default the
+// redact.DefaultBodyKeys are masked.
+func (l *EventLogger) SetRedactor(r redact.Redactor) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redactor = r
+}
+
+// TraceID returns the trace ID of the request
+func (l *EventLogger) TraceID() uuid.UUID {
+	return l.traceID
+}
+
 // Logs returns all captured logs for the request
 func (l *EventLogger) Logs() []SubLogRequest {
 	l.mu.Lock()
@@ -103,7 +118,11 @@ func (l *EventLogger) appendLog(level, msg string, metadata map[string]any, err
 	}
 
 	// Recursively redact
-	redacted := redactMetadata(copied)
+	r := l.redactor
+	if r == nil {
+		r = defaultRedactor
+	}
+	redacted := r.Metadata(cloneMetadata(copied))
 
 	entry := SubLogRequest{
 		Level:     level,
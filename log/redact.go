@@ -1,52 +1,33 @@
 package log
 
-import "strings"
+import "github.com/kulawise/kulascope-go-sdk/redact"
 
-var defaultRedactBodyKeys = []string{"password", "secret", "token"}
-
-func redactMetadata(m map[string]any) map[string]any {
-	if m == nil {
-		return nil
-	}
+// defaultRedactor applies to EventLoggers created outside a kulascope client
+var defaultRedactor = redact.Lenient(redact.Options{Rules: redact.DefaultBodyKeys})
 
+// cloneMetadata deep-copies nested maps and slices so redaction can modify
+// them without touching the caller's values
+func cloneMetadata(m map[string]any) map[string]any {
 	out := make(map[string]any, len(m))
-
 	for k, v := range m {
-		lowerKey := strings.ToLower(k)
-
-		// If the key itself is sensitive, redact regardless of value type
-		if find(defaultRedactBodyKeys, lowerKey) {
-			out[k] = "[CLIENT_REDACTED]"
-			continue
-		}
-
-		// Recurse if value is a map
-		switch val := v.(type) {
-		case map[string]any:
-			out[k] = redactMetadata(val)
-		case []any:
-			arr := make([]any, len(val))
-			for i, elem := range val {
-				if nestedMap, ok := elem.(map[string]any); ok {
-					arr[i] = redactMetadata(nestedMap)
-				} else {
-					arr[i] = elem
-				}
-			}
-			out[k] = arr
-		default:
-			out[k] = val
-		}
+		out[k] = cloneValue(v)
 	}
-
 	return out
 }
 
-func find(haystack []string, needle string) bool {
-	for _, hay := range haystack {
-		if strings.EqualFold(hay, needle) {
-			return true
+func cloneValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		return cloneMetadata(val)
+	case []any:
+		arr := make([]any, len(val))
+		for i, elem := range val {
+			arr[i] = cloneValue(elem)
 		}
+		return arr
+	case []string:
+		return append([]string(nil), val...)
+	default:
+		return val
 	}
-	return false
 }
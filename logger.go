@@ -2,24 +2,20 @@ package kulascope
 
 import (
 	"context"
-	"fmt"
 	"io"
-	"os"
-	"regexp"
 	"time"
 
 	"github.com/google/uuid"
-	// "github.com/kulawise/kulascope-go-sdk/log"
+	"github.com/kulawise/kulascope-go-sdk/redact"
 	"github.com/rs/zerolog"
 )
 
 type contextKey string
 
-const traceIDKey contextKey = "trace_id"
-
-var (
-	baseLogger zerolog.Logger
-	logChan    chan func(zerolog.Logger)
+const (
+	traceIDKey contextKey = "trace_id"
+	clientKey  contextKey = "kulascope_client"
+	spanKey    contextKey = "kulascope_span"
 )
 
 var defaultSensitiveKeys = []string{
@@ -31,53 +27,17 @@ var defaultSensitiveKeys = []string{
 	"credit_card", "cc", "cvv", "pin",
 }
 
-type redactingWriter struct {
-	w    io.Writer
-	rexs []*regexp.Regexp
-}
-
+// NewRedactingWriter returns a writer that redacts the given keys in the
+// JSON log lines written to w, using the same engine as the middleware.
+// Keys match exactly; an empty list uses defaultSensitiveKeys.
 func NewRedactingWriter(w io.Writer, keys []string) io.Writer {
 	if len(keys) == 0 {
 		keys = defaultSensitiveKeys
 	}
-	rexs := make([]*regexp.Regexp, 0, len(keys))
-	for _, k := range keys {
-
-		p := fmt.Sprintf(`(?i)("(%s)"\\s*:\\s*)"(?:[^"\\\\]|\\\\.)*"`, regexp.QuoteMeta(k))
-		rexs = append(rexs, regexp.MustCompile(p))
-	}
-	return &redactingWriter{w: w, rexs: rexs}
-}
-
-func (rw *redactingWriter) Write(p []byte) (int, error) {
-	s := string(p)
-	for _, rx := range rw.rexs {
-		s = rx.ReplaceAllString(s, `$1"[REDACTED]"`)
-	}
-	return rw.w.Write([]byte(s))
-}
-
-func Init(cfg Config) {
-	zerolog.DurationFieldUnit = time.Millisecond
-
-	w := NewRedactingWriter(os.Stdout, cfg.RedactHeaders)
-
-	baseLogger = zerolog.New(zerolog.SyncWriter(w)).With().
-		Timestamp().
-		Str("env", string(cfg.Environment)).
-		Logger()
-
-	logChan = make(chan func(zerolog.Logger), 100_000)
-	startLogWorker()
-
-	if cfg.WorkerCount <= 0 {
-		cfg.WorkerCount = 4 // safe default
-	}
-	startSenderWorkers(cfg.WorkerCount)
-
+	return redact.NewWriter(w, redact.Lenient(redact.Options{Rules: keys, KeyMatch: redact.KeyMatchExact}))
 }
 
-func startLogWorker() {
+func (c *Client) startLogWorker() {
 	go func() {
 		batch := make([]func(zerolog.Logger), 0, 100) // batch size = 100
 		ticker := time.NewTicker(100 * time.Millisecond)
@@ -85,26 +45,38 @@ func startLogWorker() {
 
 		for {
 			select {
-			case f := <-logChan:
+			case f := <-c.logChan:
 				batch = append(batch, f)
 				if len(batch) >= cap(batch) {
-					flush(batch)
+					c.flush(batch)
 					batch = batch[:0]
 				}
 			case <-ticker.C:
 				if len(batch) > 0 {
-					flush(batch)
+					c.flush(batch)
 					batch = batch[:0]
 				}
+			case <-c.stopLog:
+				for {
+					select {
+					case f := <-c.logChan:
+						batch = append(batch, f)
+					default:
+						c.flush(batch)
+						close(c.logDone)
+						return
+					}
+				}
 			}
 		}
 	}()
 }
 
-func flush(batch []func(zerolog.Logger)) {
+func (c *Client) flush(batch []func(zerolog.Logger)) {
 	for _, f := range batch {
-		f(baseLogger)
+		f(c.logger)
 	}
+	c.logPending.Add(-int64(len(batch)))
 }
 
 func WithTraceID(ctx context.Context, traceID string) context.Context {
@@ -114,11 +86,19 @@ func WithTraceID(ctx context.Context, traceID string) context.Context {
 	return context.WithValue(ctx, traceIDKey, traceID)
 }
 
-func FromContext(ctx context.Context) zerolog.Logger {
+// FromContext returns the client's logger tagged with the context's trace ID
+func (c *Client) FromContext(ctx context.Context) zerolog.Logger {
 	if traceID, ok := ctx.Value(traceIDKey).(string); ok && traceID != "" {
-		return baseLogger.With().Str("trace_id", traceID).Logger()
+		return c.logger.With().Str("trace_id", traceID).Logger()
 	}
-	return baseLogger
+	return c.logger
+}
+
+func FromContext(ctx context.Context) zerolog.Logger {
+	if c := getDefault(); c != nil {
+		return c.FromContext(ctx)
+	}
+	return zerolog.Nop()
 }
 
 func GetTraceID(ctx context.Context) string {
@@ -128,23 +108,47 @@ func GetTraceID(ctx context.Context) string {
 	return ""
 }
 
-func AsyncLog(f func(zerolog.Logger)) {
+// AsyncLog queues f to run on the client's log worker. When the queue is
+// full the oldest entry is dropped.
+func (c *Client) AsyncLog(f func(zerolog.Logger)) {
+	c.acceptMu.RLock()
+	defer c.acceptMu.RUnlock()
+	if !c.accepting.Load() {
+		// the log worker is gone after Shutdown, write synchronously
+		f(c.logger)
+		return
+	}
+
+	c.logPending.Add(1)
 	select {
-	case logChan <- f:
+	case c.logChan <- f:
 	default:
 		select {
-		case <-logChan:
+		case <-c.logChan:
+			c.logPending.Add(-1)
+			c.logDropped.Add(1)
 		default:
 		}
-		logChan <- f
+		select {
+		case c.logChan <- f:
+		case <-c.stopping:
+			c.logPending.Add(-1)
+			f(c.logger)
+		}
 	}
 }
 
-func AccessLog(ctx context.Context, method, path string, status int, start time.Time, ip string) {
+func AsyncLog(f func(zerolog.Logger)) {
+	if c := getDefault(); c != nil {
+		c.AsyncLog(f)
+	}
+}
+
+func (c *Client) AccessLog(ctx context.Context, method, path string, status int, start time.Time, ip string) {
 	duration := time.Since(start)
-	traceLogger := FromContext(ctx)
+	traceLogger := c.FromContext(ctx)
 
-	AsyncLog(func(log zerolog.Logger) {
+	c.AsyncLog(func(log zerolog.Logger) {
 		traceLogger.Info().
 			Str("method", method).
 			Str("path", path).
@@ -155,6 +159,12 @@ func AccessLog(ctx context.Context, method, path string, status int, start time.
 	})
 }
 
+func AccessLog(ctx context.Context, method, path string, status int, start time.Time, ip string) {
+	if c := getDefault(); c != nil {
+		c.AccessLog(ctx, method, path, status, start, ip)
+	}
+}
+
 // const logsKey contextKey = "request_logs"
 
 // func getLogs(ctx context.Context) []log.SubLogRequest {
@@ -0,0 +1,265 @@
+package kulascope
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultLatencyBuckets are the upper bounds of the request duration
+// histogram unless Config.LatencyBuckets is set
+var DefaultLatencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+const (
+	// unmatchedRoute labels requests that matched no route template
+	unmatchedRoute = "unmatched"
+	// otherRoute labels requests past the MetricsMaxRoutes limit
+	otherRoute = "other"
+)
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+// routeStats are the running totals for one method and route
+type routeStats struct {
+	requests int64
+	errors   int64
+	sum      time.Duration
+	// buckets counts requests per histogram bucket, not cumulative; the
+	// last one is +Inf
+	buckets []int64
+}
+
+func (s routeStats) clone() routeStats {
+	s.buckets = append([]int64(nil), s.buckets...)
+	return s
+}
+
+// routeMetrics aggregates rate, errors and duration per method and route
+type routeMetrics struct {
+	bounds    []time.Duration
+	maxRoutes int
+
+	mu     sync.Mutex
+	series map[routeKey]*routeStats
+	// reported holds the totals as of the last interval payload, and
+	// reportedAt when it was built
+	reported   map[routeKey]routeStats
+	reportedAt time.Time
+}
+
+func newRouteMetrics(bounds []time.Duration, maxRoutes int) *routeMetrics {
+	bounds = append([]time.Duration(nil), bounds...)
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	return &routeMetrics{
+		bounds:     bounds,
+		maxRoutes:  maxRoutes,
+		series:     make(map[routeKey]*routeStats),
+		reported:   make(map[routeKey]routeStats),
+		reportedAt: time.Now(),
+	}
+}
+
+// observe records one request. failed marks a server error.
+func (m *routeMetrics) observe(method, route string, d time.Duration, failed bool) {
+	if route == "" {
+		route = unmatchedRoute
+	}
+	key := routeKey{method: method, route: route}
+	bucket := sort.Search(len(m.bounds), func(i int) bool { return d <= m.bounds[i] })
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.series[key]
+	if !ok {
+		if len(m.series) >= m.maxRoutes {
+			key.route = otherRoute
+			s = m.series[key]
+		}
+		if s == nil {
+			s = &routeStats{buckets: make([]int64, len(m.bounds)+1)}
+			// the key outlives the request, and Fiber's strings don't
+			m.series[routeKey{method: strings.Clone(key.method), route: strings.Clone(key.route)}] = s
+		}
+	}
+	s.requests++
+	if failed {
+		s.errors++
+	}
+	s.sum += d
+	s.buckets[bucket]++
+}
+
+type routeSeries struct {
+	key   routeKey
+	stats routeStats
+}
+
+// snapshot copies every series, sorted by route then method
+func (m *routeMetrics) snapshot() []routeSeries {
+	m.mu.Lock()
+	out := make([]routeSeries, 0, len(m.series))
+	for k, s := range m.series {
+		out = append(out, routeSeries{key: k, stats: s.clone()})
+	}
+	m.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].key.route != out[j].key.route {
+			return out[i].key.route < out[j].key.route
+		}
+		return out[i].key.method < out[j].key.method
+	})
+	return out
+}
+
+// routeMetricsPayload is the compact form sent every RouteMetricsInterval.
+// Counts cover the interval only, and routes without traffic are left out.
+type routeMetricsPayload struct {
+	IntervalMs     int64                `json:"interval_ms"`
+	BucketBoundsMs []float64            `json:"bucket_bounds_ms"`
+	Routes         []routeMetricsRecord `json:"routes"`
+}
+
+type routeMetricsRecord struct {
+	Method   string  `json:"method"`
+	Route    string  `json:"route"`
+	Requests int64   `json:"requests"`
+	Errors   int64   `json:"errors"`
+	SumMs    float64 `json:"sum_ms"`
+	// Buckets has one count per bound plus a final +Inf bucket
+	Buckets []int64 `json:"buckets"`
+}
+
+// delta returns what was observed since the previous call
+func (m *routeMetrics) delta() routeMetricsPayload {
+	now := time.Now()
+	p := routeMetricsPayload{BucketBoundsMs: make([]float64, len(m.bounds))}
+	for i, b := range m.bounds {
+		p.BucketBoundsMs[i] = durationMs(b)
+	}
+
+	for _, rs := range m.snapshot() {
+		m.mu.Lock()
+		prev := m.reported[rs.key]
+		m.reported[rs.key] = rs.stats
+		m.mu.Unlock()
+
+		if rs.stats.requests == prev.requests {
+			continue
+		}
+		rec := routeMetricsRecord{
+			Method:   rs.key.method,
+			Route:    rs.key.route,
+			Requests: rs.stats.requests - prev.requests,
+			Errors:   rs.stats.errors - prev.errors,
+			SumMs:    durationMs(rs.stats.sum - prev.sum),
+			Buckets:  make([]int64, len(rs.stats.buckets)),
+		}
+		for i, n := range rs.stats.buckets {
+			rec.Buckets[i] = n
+			if prev.buckets != nil {
+				rec.Buckets[i] -= prev.buckets[i]
+			}
+		}
+		p.Routes = append(p.Routes, rec)
+	}
+
+	m.mu.Lock()
+	p.IntervalMs = now.Sub(m.reportedAt).Milliseconds()
+	m.reportedAt = now
+	m.mu.Unlock()
+	return p
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// writePrometheus writes the totals as Prometheus counters and a histogram
+func (m *routeMetrics) writePrometheus(w io.Writer) {
+	series := m.snapshot()
+
+	fmt.Fprintf(w, "# HELP kulascope_requests_total Requests handled, by method and route.\n# TYPE kulascope_requests_total counter\n")
+	for _, rs := range series {
+		fmt.Fprintf(w, "kulascope_requests_total{%s} %d\n", rs.key.labels(), rs.stats.requests)
+	}
+	fmt.Fprintf(w, "# HELP kulascope_request_errors_total Requests that ended in a server error, by method and route.\n# TYPE kulascope_request_errors_total counter\n")
+	for _, rs := range series {
+		fmt.Fprintf(w, "kulascope_request_errors_total{%s} %d\n", rs.key.labels(), rs.stats.errors)
+	}
+	fmt.Fprintf(w, "# HELP kulascope_request_duration_seconds Request duration, by method and route.\n# TYPE kulascope_request_duration_seconds histogram\n")
+	for _, rs := range series {
+		labels := rs.key.labels()
+		var cumulative int64
+		for i, n := range rs.stats.buckets {
+			cumulative += n
+			le := "+Inf"
+			if i < len(m.bounds) {
+				le = formatFloat(m.bounds[i].Seconds())
+			}
+			fmt.Fprintf(w, "kulascope_request_duration_seconds_bucket{%s,le=%q} %d\n", labels, le, cumulative)
+		}
+		fmt.Fprintf(w, "kulascope_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(rs.stats.sum.Seconds()))
+		fmt.Fprintf(w, "kulascope_request_duration_seconds_count{%s} %d\n", labels, rs.stats.requests)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (k routeKey) labels() string {
+	return `method="` + labelEscaper.Replace(k.method) + `",route="` + labelEscaper.Replace(k.route) + `"`
+}
+
+// observeRequest feeds a finished request into the route metrics
+func (c *Client) observeRequest(method, route string, d time.Duration, failed bool) {
+	if c.routeMetrics != nil {
+		c.routeMetrics.observe(method, route, d, failed)
+	}
+}
+
+// routeReporter queues the route metrics as a record every
+// RouteMetricsInterval until Shutdown
+func (c *Client) routeReporter() {
+	ticker := time.NewTicker(c.cfg.RouteMetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p := c.routeMetrics.delta()
+			if len(p.Routes) == 0 {
+				continue
+			}
+			c.enqueue(CreateLogRequest{
+				TraceID:   uuid.New(),
+				Level:     "info",
+				Message:   "kulascope route metrics",
+				Metadata:  map[string]any{"route_metrics": p},
+				Timestamp: time.Now(),
+			})
+		case <-c.stopLog:
+			return
+		}
+	}
+}
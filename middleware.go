@@ -1,115 +1,289 @@
 package kulascope
 
 import (
-	"os"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
 	"github.com/kulawise/kulascope-go-sdk/log"
-	"github.com/rs/zerolog"
+	"github.com/kulawise/kulascope-go-sdk/redact"
 )
 
-var defaultRedactBodyKeys = []string{
-	"password",
-	"secret",
-	"token",
-}
-
-var defaultRedactHeaderKeys = []string{
-	"authorization",
-	"cookie",
-}
+var (
+	defaultRedactBodyKeys   = redact.DefaultBodyKeys
+	defaultRedactHeaderKeys = redact.DefaultHeaderKeys
+)
 
+// Middleware creates a client from cfg, makes it the default and returns its
+// Fiber middleware. It panics if cfg is invalid; use New to handle the error.
 func Middleware(cfg Config) fiber.Handler {
-	Init(cfg)
-
-	cfg.RedactRequestBody = mergeRedactKeys(defaultRedactBodyKeys, cfg.RedactRequestBody)
-	cfg.RedactResponseBody = mergeRedactKeys(defaultRedactBodyKeys, cfg.RedactResponseBody)
-	cfg.RedactHeaders = mergeRedactKeys(defaultRedactHeaderKeys, cfg.RedactHeaders)
-
-	baseLogger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+	client, err := New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	setDefault(client)
+	return client.Middleware()
+}
 
+// Middleware returns a Fiber handler that captures every request and
+// queues it for delivery. Errors returned further down the chain are handed
+// to the app's ErrorHandler by the middleware itself, so handlers registered
+// before it see nil instead.
+func (client *Client) Middleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if !client.captures(c.Path()) {
+			return c.Next()
+		}
 		start := time.Now()
-		traceID := uuid.New()
-
-		rw := WrapResponseWriter(c)
+		// Fiber reuses the memory behind these strings once the handler
+		// returns, and the record outlives it
+		sc := extractSpanContext(func(key string) string { return strings.Clone(c.Get(key)) })
+		if !client.cfg.DisableTraceResponseHeader {
+			c.Set(client.cfg.TraceResponseHeader, sc.traceID.String())
+		}
 
 		reqHeaders := make(map[string][]string)
 		c.Request().Header.VisitAll(func(k, v []byte) {
 			reqHeaders[string(k)] = []string{string(v)}
 		})
-		redactedReqHeaders := redactHeaders(reqHeaders, cfg.RedactHeaders)
 
+		policy := client.policyFor(c.Path())
+		reqLimit, respLimit := client.bodyLimits(policy)
 		reqBody := c.Body()
-		redactedReqBody := RedactJSON(reqBody, cfg.RedactRequestBody)
+		reqSize := len(reqBody)
+		reqBody, reqTruncated := capBody(reqBody, reqLimit)
 
-		ctx := log.NewContext(c.UserContext(), &baseLogger, traceID)
+		ctx := client.newContext(c.UserContext(), sc)
 		c.SetUserContext(ctx)
 
+		own := c.Route()
 		err := c.Next()
 
+		if err != nil {
+			// run the app's error handler here rather than once the chain
+			// has returned, so the record holds the response it writes
+			if catch := c.App().ErrorHandler(c, err); catch != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+		status := c.Response().StatusCode()
+		var route string
+		if r := c.Route(); r != own {
+			// still on this middleware's own route when nothing matched
+			route = r.Path
+		}
+		client.observeRequest(c.Method(), route, time.Since(start), status >= 500)
+
+		subLogs := log.SubLogsFromContext(ctx)
+		if !client.keep(finishedRequest{
+			route:   route,
+			traceID: sc.traceID,
+			failed:  status >= 500 || err != nil,
+			latency: time.Since(start),
+			subLogs: subLogs,
+		}) {
+			return nil
+		}
+
 		resHeaders := make(map[string][]string)
 		c.Response().Header.VisitAll(func(k, v []byte) {
 			resHeaders[string(k)] = []string{string(v)}
 		})
-		redactedRespHeaders := redactHeaders(resHeaders, cfg.RedactHeaders)
 
 		respBody := c.Response().Body()
+		respSize := len(respBody)
+		respBody, respTruncated := capBody(respBody, respLimit)
 		respCopy := append([]byte(nil), respBody...)
-		redactedRespBody := RedactJSON(respCopy, cfg.RedactResponseBody)
-
-		userAgent := c.Get("User-Agent")
-		ip := c.IP()
-		// ip := c.Get("X-Forwarded-For")
-		// if ip != "" {
-
-		// 	ips := strings.Split(ip, ",")
-		// 	ip = strings.TrimSpace(ips[0])
-		// } else {
-		// 	ip = c.Get("X-Real-IP")
-		// 	if ip == "" {
-		// 		ip = c.IP()
-		// 	}
-		// }
 
-		status := c.Response().StatusCode()
-		method := c.Method()
-		path := c.Path()
-		latency := int(time.Since(start).Milliseconds())
+		client.enqueue(client.newRecord(capturedRequest{
+			span:              sc,
+			start:             start,
+			method:            strings.Clone(c.Method()),
+			path:              strings.Clone(c.Path()),
+			query:             string(c.Request().URI().QueryString()),
+			route:             route,
+			params:            fiberParams(c),
+			policy:            policy,
+			ip:                strings.Clone(c.IP()),
+			status:            status,
+			userAgent:         strings.Clone(c.Get("User-Agent")),
+			referer:           strings.Clone(c.Get("Referer")),
+			host:              string(c.Request().Host()),
+			contentType:       string(c.Request().Header.ContentType()),
+			requestHeaders:    reqHeaders,
+			requestBody:       reqBody,
+			requestSize:       reqSize,
+			requestTruncated:  reqTruncated,
+			responseHeaders:   resHeaders,
+			responseType:      string(c.Response().Header.ContentType()),
+			responseBody:      respCopy,
+			responseSize:      respSize,
+			responseTruncated: respTruncated,
+			subLogs:           subLogs,
+		}))
 
-		subLogs := log.SubLogsFromContext(ctx)
+		return nil
+	}
+}
+
+// capturedRequest is what an integration observed about a single request,
+// before redaction
+type capturedRequest struct {
+	span        spanContext
+	start       time.Time
+	method      string
+	path        string
+	query       string // raw query string
+	route       string // route template, e.g. /users/:id
+	params      map[string]string
+	policy      *routePolicy // nil when no RoutePolicy matches
+	ip          string
+	status      int
+	userAgent   string
+	referer     string
+	host        string
+	contentType string
+
+	// bodies are cut to the capture limit; the sizes are the full ones
+	requestHeaders    map[string][]string
+	requestBody       []byte
+	requestSize       int
+	requestTruncated  bool
+	responseHeaders   map[string][]string
+	responseType      string
+	responseBody      []byte
+	responseSize      int
+	responseTruncated bool
+
+	subLogs []log.SubLogRequest
+}
+
+// newRecord applies the client's redaction rules, or those of the
+// request's route policy, and builds the log payload
+func (client *Client) newRecord(cr capturedRequest) CreateLogRequest {
+	latency := int(time.Since(cr.start).Milliseconds())
 
-		metadata := map[string]any{
-			"user_agent":       userAgent,
-			"request_headers":  redactedReqHeaders,
-			"request_body":     string(redactedReqBody),
-			"response_headers": redactedRespHeaders,
-			"response_body":    string(redactedRespBody),
-			"content_type":     string(c.Request().Header.ContentType()),
-			"request_size":     len(reqBody),
-			"response_size":    rw.Size(),
-			"referer":          c.Get("Referer"),
-			"host":             string(c.Request().Host()),
+	headerRules, requestRules, responseRules := client.headerRules, client.requestRules, client.responseRules
+	skipRequest, skipResponse := "", ""
+	if p := cr.policy; p != nil {
+		headerRules, requestRules, responseRules = p.headerRules, p.requestRules, p.responseRules
+		if p.HeadersOnly {
+			skipRequest, skipResponse = "policy", "policy"
 		}
+		if p.NoResponseBody {
+			skipResponse = "policy"
+		}
+	}
+
+	metadata := map[string]any{
+		"user_agent":       cr.userAgent,
+		"request_headers":  redactURLHeaders(headerRules.Headers(cr.requestHeaders), requestRules),
+		"response_headers": redactURLHeaders(headerRules.Headers(cr.responseHeaders), requestRules),
+		"content_type":     cr.contentType,
+		"request_size":     cr.requestSize,
+		"response_size":    cr.responseSize,
+		"referer":          requestRules.URL(cr.referer),
+		"host":             cr.host,
+	}
+	captureBody(metadata, "request_body", cr.requestBody, cr.requestSize, cr.contentType, requestRules, cr.requestTruncated, skipRequest)
+	captureBody(metadata, "response_body", cr.responseBody, cr.responseSize, cr.responseType, responseRules, cr.responseTruncated, skipResponse)
+
+	if cr.query != "" {
+		metadata["query"] = requestRules.Query(cr.query)
+	}
+	if len(cr.params) > 0 {
+		params := make(map[string]any, len(cr.params))
+		for k, v := range cr.params {
+			params[k] = v
+		}
+		metadata["path_params"] = requestRules.Metadata(params)
+	}
+
+	req := CreateLogRequest{
+		TraceID:   cr.span.traceID,
+		Level:     "info",
+		Message:   "http request completed",
+		Status:    &cr.status,
+		Method:    &cr.method,
+		Path:      &cr.path,
+		Latency:   &latency,
+		IP:        &cr.ip,
+		Metadata:  metadata,
+		SubLogs:   scanSubLogs(cr.subLogs, requestRules),
+		Timestamp: time.Now(),
+	}
+	if cr.route != "" {
+		req.Route = &cr.route
+	}
+	cr.span.apply(&req)
+	return req
+}
+
+// fiberParams copies the route parameters, which Fiber only keeps valid
+// until the handler returns
+func fiberParams(c *fiber.Ctx) map[string]string {
+	all := c.AllParams()
+	params := make(map[string]string, len(all))
+	for k, v := range all {
+		params[strings.Clone(k)] = strings.Clone(v)
+	}
+	return params
+}
 
-		req := CreateLogRequest{
-			TraceID:   traceID,
-			Level:     "info",
-			Message:   "http request completed",
-			Status:    &status,
-			Method:    &method,
-			Path:      &path,
-			Latency:   &latency,
-			IP:        &ip,
-			Metadata:  metadata,
-			SubLogs:   subLogs,
-			Timestamp: time.Now(),
+// captureBody stores the redacted body under key. size is the full size of
+// the body, which may not have been kept when the route policy drops it.
+// Binary bodies, and those the route policy drops, are left empty with the
+// reason under key_skipped; a body cut to the capture limit is flagged
+// under key_truncated, and redacted as far as it goes.
+func captureBody(metadata map[string]any, key string, body []byte, size int, contentType string, rules redact.Redactor, truncated bool, skip string) {
+	metadata[key] = ""
+	if size == 0 {
+		return
+	}
+	if skip == "" && binaryContentType(contentType) {
+		skip = "binary"
+	}
+	if skip != "" {
+		metadata[key+"_skipped"] = skip
+		return
+	}
+
+	if truncated {
+		// don't leave half a UTF-8 sequence at the end
+		for len(body) > 0 {
+			if r, size := utf8.DecodeLastRune(body); r != utf8.RuneError || size != 1 {
+				break
+			}
+			body = body[:len(body)-1]
 		}
+		metadata[key+"_truncated"] = true
+	}
+	metadata[key] = string(rules.Body(body, contentType))
+}
+
+// urlHeaders carry URLs whose query strings are redacted like the
+// request's own
+var urlHeaders = []string{"Referer", "Location", "Content-Location"}
 
-		sendQueue <- sendJob{cfg: cfg, payload: req}
+// redactURLHeaders redacts the URLs in h's urlHeaders in place
+func redactURLHeaders(h map[string][]string, rules redact.Redactor) map[string][]string {
+	for k, values := range h {
+		if !find(urlHeaders, k) {
+			continue
+		}
+		for i, v := range values {
+			values[i] = rules.URL(v)
+		}
+	}
+	return h
+}
 
-		return err
+// capBody returns the first limit bytes of body, and whether that cut
+// anything off; a negative limit keeps it whole
+func capBody(body []byte, limit int) ([]byte, bool) {
+	if limit < 0 || len(body) <= limit {
+		return body, false
 	}
+	return body[:limit], true
 }
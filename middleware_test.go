@@ -0,0 +1,110 @@
+package kulascope
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestFiberHandlerErrorStatus(t *testing.T) {
+	client, flush := newTestClient(t, Config{})
+	app := fiber.New()
+	app.Use(client.Middleware())
+	app.Get("/boom", func(c *fiber.Ctx) error { return errors.New("boom") })
+	app.Get("/teapot", func(c *fiber.Ctx) error { return fiber.NewError(fiber.StatusTeapot, "short and stout") })
+
+	for path, want := range map[string]int{"/boom": 500, "/teapot": 418} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("%s answered %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+
+	statuses := make(map[string]int)
+	for _, rec := range flush() {
+		statuses[*rec.Path] = *rec.Status
+	}
+	if statuses["/boom"] != 500 || statuses["/teapot"] != 418 {
+		t.Errorf("recorded statuses %v, want /boom 500 and /teapot 418", statuses)
+	}
+
+	var metrics bytes.Buffer
+	client.writeMetrics(&metrics)
+	for _, line := range []string{
+		`kulascope_request_errors_total{method="GET",route="/boom"} 1`,
+		`kulascope_request_errors_total{method="GET",route="/teapot"} 0`,
+	} {
+		if !strings.Contains(metrics.String(), line+"\n") {
+			t.Errorf("metrics missing %q", line)
+		}
+	}
+}
+
+func TestSamplingKeepsHandlerErrors(t *testing.T) {
+	client, flush := newTestClient(t, Config{Sampling: &Sampling{Rate: 0}})
+	app := fiber.New()
+	app.Use(client.Middleware())
+	app.Get("/ok", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/bad", func(c *fiber.Ctx) error { return fiber.NewError(fiber.StatusBadRequest, "bad input") })
+
+	for _, path := range []string{"/ok", "/bad"} {
+		if _, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records := flush()
+	if len(records) != 1 || *records[0].Path != "/bad" {
+		t.Fatalf("captured %d records, want only /bad", len(records))
+	}
+	if *records[0].Status != fiber.StatusBadRequest {
+		t.Errorf("recorded status %d, want 400", *records[0].Status)
+	}
+	if n := client.Stats().SampledOut; n != 1 {
+		t.Errorf("sampled out %d requests, want 1", n)
+	}
+}
+
+func TestFiberCustomErrorHandler(t *testing.T) {
+	client, flush := newTestClient(t, Config{})
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			c.Set("X-Error", "validation")
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		},
+	})
+	app.Use(client.Middleware())
+	app.Post("/orders", func(c *fiber.Ctx) error { return errors.New("invalid order") })
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/orders", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Fatalf("answered %d, want 422", resp.StatusCode)
+	}
+
+	records := flush()
+	if len(records) != 1 {
+		t.Fatalf("captured %d records, want 1", len(records))
+	}
+	rec := records[0]
+	if *rec.Status != fiber.StatusUnprocessableEntity {
+		t.Errorf("recorded status %d, want 422", *rec.Status)
+	}
+	if body := fmt.Sprint(rec.Metadata["response_body"]); !strings.Contains(body, "invalid order") {
+		t.Errorf("recorded response body %s, want the error handler's", body)
+	}
+	if headers := fmt.Sprint(rec.Metadata["response_headers"]); !strings.Contains(headers, "validation") {
+		t.Errorf("recorded response headers %s, want X-Error", headers)
+	}
+}
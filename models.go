@@ -8,15 +8,19 @@ import (
 )
 
 type CreateLogRequest struct {
-	TraceID   uuid.UUID           `json:"trace_id"`
-	Level     string              `json:"level"`
-	Message   string              `json:"message"`
-	Metadata  map[string]any      `json:"metadata"`
-	Status    *int                `json:"status,omitempty"`
-	Method    *string             `json:"method,omitempty"`
-	Path      *string             `json:"path,omitempty"`
-	Latency   *int                `json:"latency,omitempty"`
-	IP        *string             `json:"ip,omitempty"`
-	SubLogs   []log.SubLogRequest `json:"sub_logs"`
-	Timestamp time.Time           `json:"timestamp"`
+	TraceID      uuid.UUID           `json:"trace_id"`
+	SpanID       *string             `json:"span_id,omitempty"`
+	ParentSpanID *string             `json:"parent_span_id,omitempty"`
+	Sampled      *bool               `json:"sampled,omitempty"`
+	Level        string              `json:"level"`
+	Message      string              `json:"message"`
+	Metadata     map[string]any      `json:"metadata"`
+	Status       *int                `json:"status,omitempty"`
+	Method       *string             `json:"method,omitempty"`
+	Path         *string             `json:"path,omitempty"`
+	Route        *string             `json:"route,omitempty"`
+	Latency      *int                `json:"latency,omitempty"`
+	IP           *string             `json:"ip,omitempty"`
+	SubLogs      []log.SubLogRequest `json:"sub_logs"`
+	Timestamp    time.Time           `json:"timestamp"`
 }
@@ -0,0 +1,703 @@
+package kulascope
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kulawise/kulascope-go-sdk/log"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLPEncoding selects the OTLP/HTTP payload encoding
+type OTLPEncoding string
+
+const (
+	OTLPProtobuf OTLPEncoding = "protobuf"
+	OTLPJSON     OTLPEncoding = "json"
+)
+
+// OTLPExporterConfig configures the OpenTelemetry exporter
+type OTLPExporterConfig struct {
+	// Endpoint is the collector's OTLP/HTTP base URL (default
+	// http://localhost:4318). Spans go to /v1/traces, logs to /v1/logs.
+	Endpoint string
+	// Encoding defaults to OTLPProtobuf
+	Encoding OTLPEncoding
+	// Compression defaults to none; gzip is supported by every collector
+	Compression Compression
+	// Headers are added to every request, e.g. for authentication
+	Headers map[string]string
+	// ServiceName sets the service.name resource attribute (default
+	// unknown_service:<executable>)
+	ServiceName string
+	// ResourceAttributes are added to the resource, e.g.
+	// deployment.environment.name
+	ResourceAttributes map[string]string
+	// SubLogsAsEvents attaches sub-logs to their span as events instead of
+	// sending them as log records
+	SubLogsAsEvents bool
+	// Client is used as-is; by default one is built from Transport,
+	// ProxyURL and the TLS files, as for the Kulascope ingest API
+	Client *http.Client
+	// Transport is used when Client is not set
+	Transport http.RoundTripper
+	// ProxyURL routes requests to the collector through a proxy. By default
+	// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply.
+	ProxyURL string
+	// CAFile is a PEM bundle of CAs trusted for the collector instead of
+	// the system roots
+	CAFile string
+	// ClientCertFile and ClientKeyFile hold a PEM key pair for mTLS
+	ClientCertFile string
+	ClientKeyFile  string
+	// Timeout bounds each request (default 10s)
+	Timeout time.Duration
+}
+
+type otlpExporter struct {
+	cfg      OTLPExporterConfig
+	resource *resourcepb.Resource
+}
+
+// otlpScope names the instrumentation scope of everything the SDK exports
+var otlpScope = &commonpb.InstrumentationScope{Name: "github.com/kulawise/kulascope-go-sdk"}
+
+// NewOTLPExporter returns an exporter that sends each request as an OTLP
+// server span with HTTP (or RPC) semantic-convention attributes, and its
+// sub-logs as log records or span events sharing the span's trace ID.
+// Records that are not requests, e.g. the SDK stats, become log records.
+// It fails when the proxy or TLS settings are invalid.
+func NewOTLPExporter(cfg OTLPExporterConfig) (Exporter, error) {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "http://localhost:4318"
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	if cfg.Encoding == "" {
+		cfg.Encoding = OTLPProtobuf
+	}
+	if cfg.Compression == "" {
+		cfg.Compression = CompressionNone
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "unknown_service:" + filepath.Base(os.Args[0])
+	}
+	client, err := newHTTPClient(Config{
+		HTTPClient:     cfg.Client,
+		Transport:      cfg.Transport,
+		ProxyURL:       cfg.ProxyURL,
+		CAFile:         cfg.CAFile,
+		ClientCertFile: cfg.ClientCertFile,
+		ClientKeyFile:  cfg.ClientKeyFile,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cfg.Client = client
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	attrs := []*commonpb.KeyValue{
+		stringAttr("service.name", cfg.ServiceName),
+		stringAttr("telemetry.sdk.name", "kulascope-go-sdk"),
+		stringAttr("telemetry.sdk.language", "go"),
+	}
+	keys := make([]string, 0, len(cfg.ResourceAttributes))
+	for k := range cfg.ResourceAttributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attrs = append(attrs, stringAttr(k, cfg.ResourceAttributes[k]))
+	}
+
+	return &otlpExporter{cfg: cfg, resource: &resourcepb.Resource{Attributes: attrs}}, nil
+}
+
+// Export sends the requests as spans and everything else as log records.
+// When the spans are accepted and the logs are not, a retry sends only
+// the logs, and giving up dead-letters only the records sent as logs
+// alone. Items the collector rejects in a partial success are not retried:
+// they are counted as failed, and the accepted spans are not sent again.
+func (e *otlpExporter) Export(ctx context.Context, records []CreateLogRequest) error {
+	var (
+		spans  []*tracepb.Span
+		logs   []*logspb.LogRecord
+		logged []CreateLogRequest // records sent only as log records
+		linked int                // requests whose sub-logs are log records
+	)
+	for _, r := range records {
+		if r.Method == nil {
+			// SDK stats and route metrics describe no request
+			rec := otlpLogRecord(r)
+			logs = append(logs, rec)
+			logs = append(logs, otlpLogRecords(rec.TraceId, rec.SpanId, rec.Flags, r.SubLogs)...)
+			logged = append(logged, r)
+			continue
+		}
+		span := otlpSpan(r)
+		if e.cfg.SubLogsAsEvents {
+			span.Events = otlpEvents(r.SubLogs)
+		} else if len(r.SubLogs) > 0 {
+			logs = append(logs, otlpLogRecords(span.TraceId, span.SpanId, span.Flags, r.SubLogs)...)
+			linked++
+		}
+		spans = append(spans, span)
+	}
+
+	var (
+		rejected []error
+		lost     int
+	)
+	if len(spans) > 0 {
+		traces := &tracepb.TracesData{ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource:   e.resource,
+			ScopeSpans: []*tracepb.ScopeSpans{{Scope: otlpScope, Spans: spans}},
+		}}}
+		partial, err := e.post(ctx, "/v1/traces", traces)
+		if err != nil {
+			return err
+		}
+		if partial.rejected > 0 {
+			rejected = append(rejected, fmt.Errorf("otlp /v1/traces: collector rejected %d of %d spans: %s", partial.rejected, len(spans), partial.message))
+			lost += int(partial.rejected)
+		}
+	}
+
+	var sendLogs func(ctx context.Context) error
+	sendLogs = func(ctx context.Context) error {
+		if len(logs) > 0 {
+			// TracesData and LogsData share their wire format with the
+			// collector's Export*ServiceRequest messages
+			partial, err := e.post(ctx, "/v1/logs", &logspb.LogsData{ResourceLogs: []*logspb.ResourceLogs{{
+				Resource:  e.resource,
+				ScopeLogs: []*logspb.ScopeLogs{{Scope: otlpScope, LogRecords: logs}},
+			}}})
+			if err != nil {
+				return &partialError{err: err, rest: sendLogs, undelivered: logged, lost: lost + linked}
+			}
+			if partial.rejected > 0 {
+				rejected = append(rejected, fmt.Errorf("otlp /v1/logs: collector rejected %d of %d log records: %s", partial.rejected, len(logs), partial.message))
+				lost += int(partial.rejected)
+			}
+		}
+		if len(rejected) > 0 {
+			return &partialError{err: Permanent(errors.Join(rejected...)), lost: lost}
+		}
+		return nil
+	}
+	return sendLogs(ctx)
+}
+
+func (e *otlpExporter) Shutdown(context.Context) error {
+	e.cfg.Client.CloseIdleConnections()
+	return nil
+}
+
+// otlpPartialSuccess is the partial_success field of the collector's
+// Export*ServiceResponse: how many items it rejected, and why
+type otlpPartialSuccess struct {
+	rejected int64
+	message  string
+}
+
+func (e *otlpExporter) post(ctx context.Context, path string, msg proto.Message) (otlpPartialSuccess, error) {
+	data, contentType, err := e.marshal(msg)
+	if err != nil {
+		return otlpPartialSuccess{}, err
+	}
+	body, encoding, err := compress(e.cfg.Compression, data)
+	if err != nil {
+		return otlpPartialSuccess{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.cfg.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return otlpPartialSuccess{}, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return otlpPartialSuccess{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(io.Discard, resp.Body)
+		return otlpPartialSuccess{}, fmt.Errorf("otlp %s: %w", path, newHTTPError(resp))
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxOTLPResponseBytes))
+	io.Copy(io.Discard, resp.Body)
+	return parsePartialSuccess(respBody, resp.Header.Get("Content-Type")), nil
+}
+
+// maxOTLPResponseBytes bounds how much of a collector response is read
+const maxOTLPResponseBytes = 64 << 10
+
+// parsePartialSuccess reads the partial_success field of a trace or logs
+// Export*ServiceResponse. Both messages number it 1, with the rejected
+// count as field 1 and the message as field 2. A body that does not parse
+// is an ordinary success.
+func parsePartialSuccess(body []byte, contentType string) otlpPartialSuccess {
+	if len(body) == 0 {
+		return otlpPartialSuccess{}
+	}
+	if strings.HasPrefix(contentType, "application/json") {
+		var doc struct {
+			PartialSuccess struct {
+				RejectedSpans      json.Number `json:"rejectedSpans"`
+				RejectedLogRecords json.Number `json:"rejectedLogRecords"`
+				ErrorMessage       string      `json:"errorMessage"`
+			} `json:"partialSuccess"`
+		}
+		if json.Unmarshal(body, &doc) != nil {
+			return otlpPartialSuccess{}
+		}
+		ps := doc.PartialSuccess
+		n, _ := cmp.Or(ps.RejectedSpans, ps.RejectedLogRecords).Int64()
+		return otlpPartialSuccess{rejected: n, message: ps.ErrorMessage}
+	}
+
+	partial, _ := protoField(body, 1, protowire.BytesType)
+	_, rejected := protoField(partial, 1, protowire.VarintType)
+	message, _ := protoField(partial, 2, protowire.BytesType)
+	return otlpPartialSuccess{rejected: int64(rejected), message: string(message)}
+}
+
+// protoField returns the last bytes or varint value of field num in a
+// protobuf message, or nothing if the message is malformed
+func protoField(b []byte, num protowire.Number, typ protowire.Type) ([]byte, uint64) {
+	var (
+		raw   []byte
+		value uint64
+	)
+	for len(b) > 0 {
+		n, t, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return nil, 0
+		}
+		b = b[l:]
+		switch {
+		case n == num && t == typ && t == protowire.BytesType:
+			raw, l = protowire.ConsumeBytes(b)
+		case n == num && t == typ && t == protowire.VarintType:
+			value, l = protowire.ConsumeVarint(b)
+		default:
+			l = protowire.ConsumeFieldValue(n, t, b)
+		}
+		if l < 0 {
+			return nil, 0
+		}
+		b = b[l:]
+	}
+	return raw, value
+}
+
+func (e *otlpExporter) marshal(msg proto.Message) ([]byte, string, error) {
+	if e.cfg.Encoding != OTLPJSON {
+		b, err := proto.Marshal(msg)
+		return b, "application/x-protobuf", err
+	}
+
+	// OTLP/JSON differs from protojson: enums are numbers and trace and
+	// span IDs are hex rather than base64
+	b, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(msg)
+	if err != nil {
+		return nil, "", err
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, "", err
+	}
+	hexIDs(doc)
+	b, err = json.Marshal(doc)
+	return b, "application/json", err
+}
+
+// hexIDs rewrites base64 trace and span IDs as hex
+func hexIDs(node any) {
+	switch v := node.(type) {
+	case map[string]any:
+		for k, child := range v {
+			switch k {
+			case "traceId", "spanId", "parentSpanId":
+				if s, ok := child.(string); ok {
+					if raw, err := base64.StdEncoding.DecodeString(s); err == nil {
+						v[k] = hex.EncodeToString(raw)
+					}
+				}
+			default:
+				hexIDs(child)
+			}
+		}
+	case []any:
+		for _, child := range v {
+			hexIDs(child)
+		}
+	}
+}
+
+// otlpSpan maps a record to a server span. Metadata without a semantic
+// convention is kept under kulascope.*.
+func otlpSpan(r CreateLogRequest) *tracepb.Span {
+	end := r.Timestamp
+	start := end
+	if r.Latency != nil {
+		start = end.Add(-time.Duration(*r.Latency) * time.Millisecond)
+	}
+
+	span := &tracepb.Span{
+		TraceId:           r.TraceID[:],
+		SpanId:            spanIDBytes(r.SpanID),
+		Kind:              tracepb.Span_SPAN_KIND_SERVER,
+		StartTimeUnixNano: unixNano(start),
+		EndTimeUnixNano:   unixNano(end),
+	}
+	if span.SpanId == nil {
+		span.SpanId = make([]byte, 8)
+		rand.Read(span.SpanId)
+	}
+	if r.ParentSpanID != nil {
+		span.ParentSpanId = spanIDBytes(r.ParentSpanID)
+	}
+	if r.Sampled == nil || *r.Sampled {
+		span.Flags = 1 // W3C sampled flag
+	}
+
+	meta := make(map[string]any, len(r.Metadata))
+	for k, v := range r.Metadata {
+		meta[k] = v
+	}
+	if ts, ok := meta["tracestate"].(string); ok {
+		span.TraceState = ts
+		delete(meta, "tracestate")
+	}
+
+	method, path, status := deref(r.Method), deref(r.Path), 0
+	if r.Status != nil {
+		status = *r.Status
+	}
+	var attrs []*commonpb.KeyValue
+	if ip := deref(r.IP); ip != "" {
+		attrs = append(attrs, stringAttr("client.address", ip))
+	}
+	if ua, _ := meta["user_agent"].(string); ua != "" {
+		attrs = append(attrs, stringAttr("user_agent.original", ua))
+	}
+	delete(meta, "user_agent")
+
+	if method == "GRPC" {
+		full := strings.TrimPrefix(path, "/")
+		span.Name = full
+		service, rpcMethod, _ := strings.Cut(full, "/")
+		attrs = append(attrs,
+			stringAttr("rpc.system", "grpc"),
+			stringAttr("rpc.service", service),
+			stringAttr("rpc.method", rpcMethod),
+			intAttr("rpc.grpc.status_code", int64(status)),
+		)
+		attrs = append(attrs, headerAttrs("rpc.grpc.request.metadata.", meta["request_metadata"])...)
+		delete(meta, "request_metadata")
+		delete(meta, "grpc_code")
+		if grpcServerError(status) {
+			span.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: fmt.Sprint(meta["error"])}
+		}
+	} else {
+		route := deref(r.Route)
+		span.Name = strings.TrimSpace(method + " " + cmp.Or(route, path))
+		attrs = append(attrs,
+			stringAttr("http.request.method", method),
+			stringAttr("url.path", path),
+			intAttr("http.response.status_code", int64(status)),
+		)
+		if route != "" {
+			attrs = append(attrs, stringAttr("http.route", route))
+		}
+		if host, _ := meta["host"].(string); host != "" {
+			attrs = append(attrs, stringAttr("server.address", host))
+		}
+		if n, ok := toInt(meta["request_size"]); ok {
+			attrs = append(attrs, intAttr("http.request.body.size", n))
+		}
+		if n, ok := toInt(meta["response_size"]); ok {
+			attrs = append(attrs, intAttr("http.response.body.size", n))
+		}
+		attrs = append(attrs, headerAttrs("http.request.header.", meta["request_headers"])...)
+		attrs = append(attrs, headerAttrs("http.response.header.", meta["response_headers"])...)
+		for _, k := range []string{"host", "request_size", "response_size", "request_headers", "response_headers"} {
+			delete(meta, k)
+		}
+		if status >= 500 {
+			span.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR}
+		}
+	}
+
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attrs = append(attrs, &commonpb.KeyValue{Key: "kulascope." + k, Value: anyValue(meta[k])})
+	}
+	span.Attributes = attrs
+	return span
+}
+
+// otlpLogRecord maps a record that is not a request to a log record
+func otlpLogRecord(r CreateLogRequest) *logspb.LogRecord {
+	rec := &logspb.LogRecord{
+		TimeUnixNano:         unixNano(r.Timestamp),
+		ObservedTimeUnixNano: unixNano(r.Timestamp),
+		SeverityNumber:       severityNumber(r.Level),
+		SeverityText:         r.Level,
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: r.Message}},
+		TraceId:              r.TraceID[:],
+		SpanId:               spanIDBytes(r.SpanID),
+	}
+	if r.Sampled == nil || *r.Sampled {
+		rec.Flags = 1 // W3C sampled flag
+	}
+	keys := make([]string, 0, len(r.Metadata))
+	for k := range r.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rec.Attributes = append(rec.Attributes, &commonpb.KeyValue{Key: "kulascope." + k, Value: anyValue(r.Metadata[k])})
+	}
+	return rec
+}
+
+// otlpLogRecords maps sub-logs to log records correlated with a span, or
+// with a trace alone when spanID is nil
+func otlpLogRecords(traceID, spanID []byte, flags uint32, logs []log.SubLogRequest) []*logspb.LogRecord {
+	out := make([]*logspb.LogRecord, 0, len(logs))
+	for _, l := range logs {
+		out = append(out, &logspb.LogRecord{
+			TimeUnixNano:         unixNano(l.Timestamp),
+			ObservedTimeUnixNano: unixNano(l.Timestamp),
+			SeverityNumber:       severityNumber(l.Level),
+			SeverityText:         l.Level,
+			Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: l.Message}},
+			Attributes:           subLogAttrs(l),
+			Flags:                flags,
+			TraceId:              traceID,
+			SpanId:               spanID,
+		})
+	}
+	return out
+}
+
+// otlpEvents maps sub-logs to span events
+func otlpEvents(logs []log.SubLogRequest) []*tracepb.Span_Event {
+	out := make([]*tracepb.Span_Event, 0, len(logs))
+	for _, l := range logs {
+		attrs := append([]*commonpb.KeyValue{stringAttr("log.severity", l.Level)}, subLogAttrs(l)...)
+		out = append(out, &tracepb.Span_Event{
+			TimeUnixNano: unixNano(l.Timestamp),
+			Name:         l.Message,
+			Attributes:   attrs,
+		})
+	}
+	return out
+}
+
+func subLogAttrs(l log.SubLogRequest) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(l.Metadata))
+	for k := range l.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]*commonpb.KeyValue, 0, len(keys)+1)
+	for _, k := range keys {
+		attrs = append(attrs, &commonpb.KeyValue{Key: k, Value: anyValue(l.Metadata[k])})
+	}
+	if l.Error != "" {
+		attrs = append(attrs, stringAttr("exception.message", l.Error))
+	}
+	return attrs
+}
+
+func severityNumber(level string) logspb.SeverityNumber {
+	switch level {
+	case "trace":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_TRACE
+	case "debug":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case "warn":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case "error":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	case "fatal", "panic":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	}
+}
+
+// grpcServerError reports whether a status code marks a server span as
+// failed, per the RPC semantic conventions
+func grpcServerError(code int) bool {
+	switch code {
+	case 2, 4, 12, 13, 14, 15: // Unknown, DeadlineExceeded, Unimplemented, Internal, Unavailable, DataLoss
+		return true
+	}
+	return false
+}
+
+// headerAttrs maps captured headers to one string-array attribute each.
+// Headers decoded from the spool arrive as map[string]any.
+func headerAttrs(prefix string, headers any) []*commonpb.KeyValue {
+	values := map[string][]string{}
+	switch h := headers.(type) {
+	case map[string][]string:
+		values = h
+	case map[string]any:
+		for k, v := range h {
+			list, _ := v.([]any)
+			for _, item := range list {
+				values[k] = append(values[k], fmt.Sprint(item))
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, &commonpb.KeyValue{Key: prefix + strings.ToLower(k), Value: anyValue(values[k])})
+	}
+	return attrs
+}
+
+// anyValue converts a metadata value to an OTLP value. Anything without
+// a direct mapping is sent as its JSON encoding.
+func anyValue(v any) *commonpb.AnyValue {
+	switch val := v.(type) {
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: val}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: val}}
+	case int:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case int64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: val}}
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: val}}
+	case []string:
+		arr := make([]*commonpb.AnyValue, len(val))
+		for i, s := range val {
+			arr[i] = anyValue(s)
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: arr}}}
+	case []any:
+		arr := make([]*commonpb.AnyValue, len(val))
+		for i, item := range val {
+			arr[i] = anyValue(item)
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: arr}}}
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		kvs := make([]*commonpb.KeyValue, len(keys))
+		for i, k := range keys {
+			kvs[i] = &commonpb.KeyValue{Key: k, Value: anyValue(val[k])}
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: kvs}}}
+	case nil:
+		return &commonpb.AnyValue{}
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return anyValue(fmt.Sprint(val))
+		}
+		return anyValue(string(b))
+	}
+}
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: anyValue(value)}
+}
+
+func intAttr(key string, value int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: anyValue(value)}
+}
+
+func toInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// spanIDBytes decodes a 16-character hex span ID
+func spanIDBytes(id *string) []byte {
+	if id == nil {
+		return nil
+	}
+	b, err := hex.DecodeString(*id)
+	if err != nil || len(b) != 8 {
+		return nil
+	}
+	return b
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
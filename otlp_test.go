@@ -0,0 +1,451 @@
+package kulascope
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/kulawise/kulascope-go-sdk/log"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is a stand-in OTLP/HTTP collector that keeps every request body
+type collector struct {
+	mu     sync.Mutex
+	bodies map[string][][]byte
+	types  map[string]string
+}
+
+func newCollector(t *testing.T) (*collector, *httptest.Server) {
+	c := &collector{bodies: map[string][][]byte{}, types: map[string]string{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		c.mu.Lock()
+		c.bodies[r.URL.Path] = append(c.bodies[r.URL.Path], b)
+		c.types[r.URL.Path] = r.Header.Get("Content-Type")
+		c.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	return c, srv
+}
+
+func (c *collector) only(t *testing.T, path string) []byte {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.bodies[path]) != 1 {
+		t.Fatalf("%s: got %d requests, want 1", path, len(c.bodies[path]))
+	}
+	return c.bodies[path][0]
+}
+
+func TestOTLPExporterProtobuf(t *testing.T) {
+	coll, srv := newCollector(t)
+
+	exp, err := NewOTLPExporter(OTLPExporterConfig{Endpoint: srv.URL, ServiceName: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(Config{Exporter: exp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown(context.Background())
+
+	app := fiber.New()
+	app.Use(client.Middleware())
+	app.Get("/users", func(c *fiber.Ctx) error {
+		log.FromContext(c.UserContext()).Warn().Str("user", "42").Msg("slow lookup")
+		return c.SendStatus(fiber.StatusServiceUnavailable)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var traces tracepb.TracesData
+	if err := proto.Unmarshal(coll.only(t, "/v1/traces"), &traces); err != nil {
+		t.Fatal(err)
+	}
+	if ct := coll.types["/v1/traces"]; ct != "application/x-protobuf" {
+		t.Errorf("traces content type = %q", ct)
+	}
+	rs := traces.ResourceSpans[0]
+	if got := attrString(rs.Resource.Attributes, "service.name"); got != "orders" {
+		t.Errorf("service.name = %q", got)
+	}
+	span := rs.ScopeSpans[0].Spans[0]
+	if got := hex.EncodeToString(span.TraceId); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s", got)
+	}
+	if got := hex.EncodeToString(span.ParentSpanId); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span ID = %s", got)
+	}
+	if span.Name != "GET /users" || span.Kind != tracepb.Span_SPAN_KIND_SERVER {
+		t.Errorf("span = %q kind %v", span.Name, span.Kind)
+	}
+	if span.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR {
+		t.Errorf("status = %v, want error for a 503", span.Status)
+	}
+	if got := attrInt(span.Attributes, "http.response.status_code"); got != 503 {
+		t.Errorf("http.response.status_code = %d", got)
+	}
+	if got := attrString(span.Attributes, "http.request.method"); got != "GET" {
+		t.Errorf("http.request.method = %q", got)
+	}
+
+	var logs logspb.LogsData
+	if err := proto.Unmarshal(coll.only(t, "/v1/logs"), &logs); err != nil {
+		t.Fatal(err)
+	}
+	rec := logs.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if !bytes.Equal(rec.TraceId, span.TraceId) || !bytes.Equal(rec.SpanId, span.SpanId) {
+		t.Error("log record is not linked to the span")
+	}
+	if rec.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_WARN || rec.Body.GetStringValue() != "slow lookup" {
+		t.Errorf("log record = %v %q", rec.SeverityNumber, rec.Body.GetStringValue())
+	}
+	if got := attrString(rec.Attributes, "user"); got != "42" {
+		t.Errorf("user attribute = %q", got)
+	}
+}
+
+func TestOTLPExporterJSONEvents(t *testing.T) {
+	coll, srv := newCollector(t)
+	exp, err := NewOTLPExporter(OTLPExporterConfig{Endpoint: srv.URL, Encoding: OTLPJSON, SubLogsAsEvents: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traceID := uuid.MustParse("4bf92f35-77b3-4da6-a3ce-929d0e0e4736")
+	spanID, method, path, status, latency := "00f067aa0ba902b7", "POST", "/orders", 201, 12
+	err = exp.Export(context.Background(), []CreateLogRequest{{
+		TraceID:   traceID,
+		SpanID:    &spanID,
+		Method:    &method,
+		Path:      &path,
+		Status:    &status,
+		Latency:   &latency,
+		Timestamp: time.Now(),
+		SubLogs:   []log.SubLogRequest{{Level: "info", Message: "created", Timestamp: time.Now()}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID string `json:"traceId"`
+					SpanID  string `json:"spanId"`
+					Kind    int    `json:"kind"`
+					Events  []struct {
+						Name string `json:"name"`
+					} `json:"events"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(coll.only(t, "/v1/traces"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	span := doc.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.SpanID != spanID {
+		t.Errorf("IDs = %s/%s, want hex", span.TraceID, span.SpanID)
+	}
+	if span.Kind != int(tracepb.Span_SPAN_KIND_SERVER) {
+		t.Errorf("kind = %d", span.Kind)
+	}
+	if len(span.Events) != 1 || span.Events[0].Name != "created" {
+		t.Errorf("events = %+v", span.Events)
+	}
+	if len(coll.bodies["/v1/logs"]) != 0 {
+		t.Error("sub-logs sent as log records despite SubLogsAsEvents")
+	}
+}
+
+func TestOTLPExporterRetriesLogsAlone(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = map[string]int{}
+		logs     logspb.LogsData
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		requests[r.URL.Path]++
+		if r.URL.Path == "/v1/logs" {
+			if requests[r.URL.Path] == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			proto.Unmarshal(b, &logs)
+		}
+	}))
+	defer srv.Close()
+	exp, err := NewOTLPExporter(OTLPExporterConfig{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	method, path := "GET", "/users"
+	records := []CreateLogRequest{
+		{
+			TraceID:   uuid.New(),
+			Method:    &method,
+			Path:      &path,
+			Timestamp: time.Now(),
+			SubLogs:   []log.SubLogRequest{{Level: "info", Message: "found", Timestamp: time.Now()}},
+		},
+		{
+			TraceID:   uuid.New(),
+			Level:     "info",
+			Message:   "kulascope sdk stats",
+			Metadata:  map[string]any{"sdk_stats": "x"},
+			Timestamp: time.Now(),
+		},
+	}
+	r := retrier{policy: RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}}
+	if err := r.export(context.Background(), exp, records); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests["/v1/traces"] != 1 || requests["/v1/logs"] != 2 {
+		t.Errorf("requests = %v, want the spans once and the logs twice", requests)
+	}
+	recs := logs.ResourceLogs[0].ScopeLogs[0].LogRecords
+	if len(recs) != 2 {
+		t.Fatalf("got %d log records, want 2", len(recs))
+	}
+	var stats *logspb.LogRecord
+	for _, rec := range recs {
+		if rec.Body.GetStringValue() == "kulascope sdk stats" {
+			stats = rec
+		}
+	}
+	if stats == nil {
+		t.Fatal("stats record not sent as a log record")
+	}
+	if stats.SpanId != nil || attrString(stats.Attributes, "kulascope.sdk_stats") != "x" {
+		t.Errorf("stats record = %v", stats)
+	}
+}
+
+func attrString(attrs []*commonpb.KeyValue, key string) string {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value.GetStringValue()
+		}
+	}
+	return ""
+}
+
+func attrInt(attrs []*commonpb.KeyValue, key string) int64 {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value.GetIntValue()
+		}
+	}
+	return 0
+}
+
+func TestOTLPExporterPartialSuccess(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = map[string]int{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/v1/traces" {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"partialSuccess":{"rejectedSpans":"1","errorMessage":"span too large"}}`)
+		}
+	}))
+	defer srv.Close()
+	exp, err := NewOTLPExporter(OTLPExporterConfig{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deadLetters atomic.Int64
+	client, err := New(Config{
+		APIKey:         "test",
+		Exporter:       exp,
+		WorkerCount:    1,
+		DisableBreaker: true,
+		Retry:          RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		DeadLetter: DeadLetterFunc(func(records []CreateLogRequest, _ error) error {
+			deadLetters.Add(int64(len(records)))
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown(context.Background())
+
+	method, path := "GET", "/users"
+	for range 3 {
+		client.enqueue(CreateLogRequest{TraceID: uuid.New(), Method: &method, Path: &path, Timestamp: time.Now()})
+	}
+	if _, err := client.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "span too large") {
+		t.Errorf("Flush = %v, want the collector's rejection", err)
+	}
+
+	// the collector rejects one span of every batch, which is not retried
+	s := client.Stats()
+	batches := requests["/v1/traces"]
+	if int64(batches) != s.BatchesRejected {
+		t.Errorf("spans sent %d times for %d batches, want no retries", batches, s.BatchesRejected)
+	}
+	if n := deadLetters.Load(); n != 0 {
+		t.Errorf("dead-lettered %d records, want none", n)
+	}
+	if s.Delivered != int64(3-batches) || s.Failed != int64(batches) {
+		t.Errorf("delivered %d and failed %d in %d batches", s.Delivered, s.Failed, batches)
+	}
+}
+
+func TestParsePartialSuccess(t *testing.T) {
+	var partial []byte
+	partial = protowire.AppendTag(partial, 1, protowire.VarintType)
+	partial = protowire.AppendVarint(partial, 7)
+	partial = protowire.AppendTag(partial, 2, protowire.BytesType)
+	partial = protowire.AppendString(partial, "bad attribute")
+	var body []byte
+	body = protowire.AppendTag(body, 9, protowire.VarintType) // unknown field
+	body = protowire.AppendVarint(body, 1)
+	body = protowire.AppendTag(body, 1, protowire.BytesType)
+	body = protowire.AppendBytes(body, partial)
+
+	for _, tc := range []struct {
+		body, contentType string
+		want              otlpPartialSuccess
+	}{
+		{string(body), "application/x-protobuf", otlpPartialSuccess{7, "bad attribute"}},
+		{`{"partialSuccess":{"rejectedLogRecords":3,"errorMessage":"x"}}`, "application/json", otlpPartialSuccess{3, "x"}},
+		{`{"partialSuccess":{}}`, "application/json", otlpPartialSuccess{}},
+		{"", "application/x-protobuf", otlpPartialSuccess{}},
+		{"\xff\xff", "application/x-protobuf", otlpPartialSuccess{}},
+	} {
+		if got := parsePartialSuccess([]byte(tc.body), tc.contentType); got != tc.want {
+			t.Errorf("%q: got %+v, want %+v", tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestOTLPExporterDeadLettersLogsAlone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.URL.Path == "/v1/logs" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	exp, err := NewOTLPExporter(OTLPExporterConfig{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dead []CreateLogRequest
+	client, err := New(Config{
+		APIKey:         "test",
+		Exporter:       exp,
+		WorkerCount:    1,
+		DisableBreaker: true,
+		DeadLetter: DeadLetterFunc(func(records []CreateLogRequest, _ error) error {
+			dead = append(dead, records...)
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown(context.Background())
+
+	method, path := "GET", "/users"
+	client.enqueue(CreateLogRequest{TraceID: uuid.New(), Method: &method, Path: &path, Timestamp: time.Now()})
+	client.enqueue(CreateLogRequest{
+		TraceID:   uuid.New(),
+		Method:    &method,
+		Path:      &path,
+		Timestamp: time.Now(),
+		SubLogs:   []log.SubLogRequest{{Level: "info", Message: "found", Timestamp: time.Now()}},
+	})
+	client.enqueue(CreateLogRequest{TraceID: uuid.New(), Level: "info", Message: "kulascope sdk stats", Timestamp: time.Now()})
+	client.Flush(context.Background())
+
+	if len(dead) != 1 || dead[0].Message != "kulascope sdk stats" {
+		t.Errorf("dead-lettered %+v, want only the stats record", dead)
+	}
+	if s := client.Stats(); s.Delivered != 1 || s.Failed != 2 {
+		t.Errorf("delivered %d and failed %d, want 1 and 2", s.Delivered, s.Failed)
+	}
+}
+
+func TestOTLPExporterCAFile(t *testing.T) {
+	coll := &collector{bodies: map[string][][]byte{}, types: map[string]string{}}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		coll.mu.Lock()
+		coll.bodies[r.URL.Path] = append(coll.bodies[r.URL.Path], b)
+		coll.mu.Unlock()
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	method, path := "GET", "/users"
+	records := []CreateLogRequest{{TraceID: uuid.New(), Method: &method, Path: &path, Timestamp: time.Now()}}
+	exp, err := NewOTLPExporter(OTLPExporterConfig{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exp.Export(context.Background(), records); err == nil {
+		t.Error("export without CAFile trusted the test server")
+	}
+	exp, err = NewOTLPExporter(OTLPExporterConfig{Endpoint: srv.URL, CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exp.Export(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+	coll.only(t, "/v1/traces")
+
+	if _, err := NewOTLPExporter(OTLPExporterConfig{ProxyURL: "http://bad host"}); err == nil {
+		t.Error("invalid ProxyURL accepted")
+	}
+}
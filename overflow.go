@@ -0,0 +1,188 @@
+package kulascope
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OverflowPolicy decides what happens to a record when the send queue is
+// full, e.g. because the ingest API is down
+type OverflowPolicy string
+
+const (
+	// OverflowDropOldest drops the oldest queued record to make room
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowDropNewest drops the record being queued
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	// OverflowSpill writes the record to OverflowDir and queues it again
+	// once the queue drains. If the write fails the record is dropped.
+	OverflowSpill OverflowPolicy = "spill"
+	// OverflowBlock waits for room in the queue. The request being logged
+	// waits too, so its latency depends on the ingest API.
+	OverflowBlock OverflowPolicy = "block"
+)
+
+// overflowJob applies the overflow policy to a job the full queue had no
+// room for. It never blocks unless the policy is OverflowBlock, and then
+// only until Shutdown is called; it reports false if Shutdown cut it short.
+func (c *Client) overflowJob(job sendJob, policy OverflowPolicy) bool {
+	switch policy {
+	case OverflowBlock:
+		select {
+		case c.sendQueue <- job:
+			return true
+		case <-c.stopping:
+			// a spooled record stays on disk for the next start
+			c.pending.Add(-1)
+			c.failed.Add(1)
+			return false
+		}
+	case OverflowSpill:
+		if c.spill(job) {
+			return true
+		}
+	case OverflowDropOldest:
+		select {
+		case old := <-c.sendQueue:
+			c.drop(old)
+		default:
+		}
+		select {
+		case c.sendQueue <- job:
+			return true
+		default:
+		}
+	}
+	c.drop(job)
+	return true
+}
+
+// drop gives up on a job that was counted as pending
+func (c *Client) drop(job sendJob) {
+	c.pending.Add(-1)
+	c.failed.Add(1)
+	c.dropped.Add(1)
+	if job.seg != nil {
+		c.spool.ack(job.seg, job.frame)
+	}
+}
+
+// spill moves the job to the overflow spool. It stays pending until the
+// drainer has queued it again.
+func (c *Client) spill(job sendJob) bool {
+	body := job.body
+	if body == nil {
+		var err error
+		if body, err = json.Marshal(job.payload); err != nil {
+			return false
+		}
+	}
+	if _, _, err := c.overflow.append(body); err != nil {
+		c.logger.Error().Err(err).Msg("failed to spill log")
+		return false
+	}
+	if job.seg != nil {
+		// the overflow spool holds it now
+		c.spool.ack(job.seg, job.frame)
+	}
+	c.spilled.Add(1)
+	select {
+	case c.overflowWake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// overflowDrainer queues spilled records again whenever the send queue is
+// at most half full. Records still on disk when it stops are picked up on
+// the next start.
+func (c *Client) overflowDrainer() {
+	defer close(c.overflowDone)
+
+	ticker := time.NewTicker(c.cfg.BatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.overflowWake:
+		case <-ticker.C:
+		case <-c.stopOverflow:
+			return
+		}
+		if !c.drainOverflow() {
+			return
+		}
+	}
+}
+
+// drainOverflow moves whole spilled segments back into the send queue
+// while it has room. It returns false once the drainer is stopped.
+func (c *Client) drainOverflow() bool {
+	for len(c.sendQueue) <= cap(c.sendQueue)/2 {
+		seg, bodies, err := c.overflow.takeOldest()
+		if err != nil {
+			c.logger.Error().Err(err).Msg("failed to read spilled logs")
+			return true
+		}
+		if seg == nil {
+			return true
+		}
+		if lost := seg.records - len(bodies); lost > 0 {
+			// torn tail, e.g. a crash mid-write
+			c.pending.Add(-int64(lost))
+			c.failed.Add(int64(lost))
+		}
+
+		for _, body := range bodies {
+			var payload CreateLogRequest
+			if err := json.Unmarshal(body, &payload); err != nil {
+				c.logger.Error().Err(err).Msg("failed to decode spilled log")
+				c.pending.Add(-1)
+				c.failed.Add(1)
+				continue
+			}
+			job := sendJob{payload: payload, body: body}
+			if c.spool != nil {
+				if job.seg, job.frame, err = c.spool.append(body); err != nil {
+					c.logger.Error().Err(err).Msg("failed to spool log")
+				}
+			}
+			select {
+			case c.sendQueue <- job:
+			case <-c.stopOverflow:
+				// the whole segment is replayed on the next start, so
+				// records queued from it so far may be sent twice
+				if job.seg != nil {
+					c.spool.ack(job.seg, job.frame)
+				}
+				return false
+			}
+		}
+		c.overflow.ackAll(seg)
+	}
+	return true
+}
+
+// openOverflow opens the overflow spool and counts records left over from
+// a previous process as pending, for the drainer to pick up
+func (c *Client) openOverflow() error {
+	cfg := c.cfg
+	cfg.SpoolDir = cfg.OverflowDir
+	s, leftover, err := openSpool(cfg)
+	if err != nil {
+		return err
+	}
+	s.onEvict = func(records int) {
+		c.pending.Add(-int64(records))
+		c.failed.Add(int64(records))
+		c.dropped.Add(int64(records))
+	}
+	for _, rb := range leftover {
+		c.pending.Add(int64(len(rb.bodies)))
+	}
+	c.overflow = s
+	c.overflowWake = make(chan struct{}, 1)
+	c.stopOverflow = make(chan struct{})
+	c.overflowDone = make(chan struct{})
+	return nil
+}
@@ -0,0 +1,114 @@
+package kulascope
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// queueClient returns a client whose send queue holds two records and has
+// no workers draining it
+func queueClient(t *testing.T, policy OverflowPolicy) *Client {
+	cfg := Config{APIKey: "test", QueueOverflow: policy, OverflowDir: t.TempDir()}
+	cfg.setDefaults()
+	c := &Client{cfg: cfg, logger: zerolog.Nop(), sendQueue: make(chan sendJob, 2)}
+	c.accepting.Store(true)
+	if policy == OverflowSpill {
+		if err := c.openOverflow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func queued(c *Client) []string {
+	var msgs []string
+	for len(c.sendQueue) > 0 {
+		msgs = append(msgs, (<-c.sendQueue).payload.Message)
+	}
+	return msgs
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy  OverflowPolicy
+		queued  []string
+		dropped int64
+		spilled int64
+	}{
+		{OverflowDropOldest, []string{"b", "c"}, 1, 0},
+		{OverflowDropNewest, []string{"a", "b"}, 1, 0},
+		{OverflowSpill, []string{"a", "b"}, 0, 1},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			c := queueClient(t, tc.policy)
+			for _, msg := range []string{"a", "b", "c"} {
+				c.enqueue(CreateLogRequest{Message: msg})
+			}
+
+			if got := queued(c); !slices.Equal(got, tc.queued) {
+				t.Errorf("queued %v, want %v", got, tc.queued)
+			}
+			if got := c.dropped.Load(); got != tc.dropped {
+				t.Errorf("dropped = %d, want %d", got, tc.dropped)
+			}
+			if got := c.failed.Load(); got != tc.dropped {
+				t.Errorf("failed = %d, want %d", got, tc.dropped)
+			}
+			if got := c.spilled.Load(); got != tc.spilled {
+				t.Errorf("spilled = %d, want %d", got, tc.spilled)
+			}
+			// a spilled record stays pending until it is delivered
+			if got := c.pending.Load(); got != 3-tc.dropped {
+				t.Errorf("pending = %d, want %d", got, 3-tc.dropped)
+			}
+		})
+	}
+}
+
+func TestOverflowSpillDrains(t *testing.T) {
+	c := queueClient(t, OverflowSpill)
+	for _, msg := range []string{"a", "b", "c"} {
+		c.enqueue(CreateLogRequest{Message: msg})
+	}
+	queued(c)
+
+	if !c.drainOverflow() {
+		t.Fatal("drainer stopped")
+	}
+	if got := queued(c); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("queued %v after draining, want [c]", got)
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	c := queueClient(t, OverflowBlock)
+	c.enqueue(CreateLogRequest{Message: "a"})
+	c.enqueue(CreateLogRequest{Message: "b"})
+
+	done := make(chan struct{})
+	go func() {
+		c.enqueue(CreateLogRequest{Message: "c"})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("enqueue returned while the queue was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-c.sendQueue
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue still blocked once the queue had room")
+	}
+	if got := queued(c); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("queued %v, want [b c]", got)
+	}
+	if c.dropped.Load() != 0 {
+		t.Errorf("dropped = %d, want 0", c.dropped.Load())
+	}
+}
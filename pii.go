@@ -0,0 +1,39 @@
+package kulascope
+
+import (
+	"github.com/kulawise/kulascope-go-sdk/log"
+	"github.com/kulawise/kulascope-go-sdk/redact"
+)
+
+// Detector finds sensitive values inside free-form strings, regardless of
+// the key they are stored under. Every match is replaced with
+// [REDACTED:<label>], unless Config.RedactStrategies has an entry for the
+// label.
+type Detector = redact.Detector
+
+// NewRegexDetector returns a Detector for a custom pattern
+func NewRegexDetector(label, pattern string) (Detector, error) {
+	return redact.NewRegexDetector(label, pattern)
+}
+
+// Built-in detectors
+func BearerTokenDetector() Detector { return redact.BearerTokenDetector() }
+func JWTDetector() Detector         { return redact.JWTDetector() }
+func AWSKeyDetector() Detector      { return redact.AWSKeyDetector() }
+func CardDetector() Detector        { return redact.CardDetector() }
+func IBANDetector() Detector        { return redact.IBANDetector() }
+func EmailDetector() Detector       { return redact.EmailDetector() }
+func PhoneDetector() Detector       { return redact.PhoneDetector() }
+
+// DefaultDetectors returns every built-in detector
+func DefaultDetectors() []Detector { return redact.DefaultDetectors() }
+
+// scanSubLogs masks detector matches in sub-log messages and errors.
+// Metadata is redacted by the EventLogger as each entry is written.
+func scanSubLogs(logs []log.SubLogRequest, rules redact.Redactor) []log.SubLogRequest {
+	for i := range logs {
+		logs[i].Message = rules.String(logs[i].Message)
+		logs[i].Error = rules.String(logs[i].Error)
+	}
+	return logs
+}
@@ -0,0 +1,295 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+func (r *rules) Body(data []byte, contentType string) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		return r.form(data)
+	case mediaType == "multipart/form-data" && params["boundary"] != "":
+		return r.multipart(data, params["boundary"])
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return r.xml(data)
+	case mediaType == "text/plain":
+		// JSON is often served as text/plain
+		if _, ok := completeJSON(data); !ok {
+			return []byte(r.text(string(data)))
+		}
+	}
+	return r.JSON(data)
+}
+
+// formPair is one field of a url-encoded form or query string
+type formPair struct {
+	key, value string
+	hasValue   bool
+}
+
+// parseForm splits a url-encoded form into its fields, in order, and a
+// map of them where repeated fields are lists
+func parseForm(s string) ([]formPair, map[string]any) {
+	var pairs []formPair
+	fields := make(map[string]any)
+	for _, p := range strings.Split(s, "&") {
+		if p == "" {
+			continue
+		}
+		k, v, hasValue := strings.Cut(p, "=")
+		if uk, err := url.QueryUnescape(k); err == nil {
+			k = uk
+		}
+		if uv, err := url.QueryUnescape(v); err == nil {
+			v = uv
+		}
+		pairs = append(pairs, formPair{k, v, hasValue})
+		addField(fields, k, v)
+	}
+	return pairs, fields
+}
+
+// form redacts a url-encoded form, keeping the order of its fields
+func (r *rules) form(data []byte) []byte {
+	pairs, fields := parseForm(string(data))
+	r.Value(fields)
+
+	var b strings.Builder
+	seen := make(map[string]int)
+	for _, p := range pairs {
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(p.key))
+		if p.hasValue {
+			b.WriteByte('=')
+			b.WriteString(url.QueryEscape(fieldValue(fields[p.key], seen[p.key])))
+		}
+		seen[p.key]++
+	}
+	return []byte(b.String())
+}
+
+// addField adds a form value, turning repeated fields into a list
+func addField(fields map[string]any, key, value string) {
+	switch v := fields[key].(type) {
+	case nil:
+		fields[key] = value
+	case []any:
+		fields[key] = append(v, value)
+	default:
+		fields[key] = []any{v, value}
+	}
+}
+
+// fieldValue returns the i-th value of a redacted form field. A list
+// redacted as a whole gives the same value for every position.
+func fieldValue(v any, i int) string {
+	if list, ok := v.([]any); ok {
+		if i >= len(list) {
+			return ""
+		}
+		v = list[i]
+	}
+	if s, ok := stringify(v); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// fileSummary stands in for a multipart file, whose content is never kept
+type fileSummary struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+}
+
+// multipart redacts the fields of a multipart form and summarizes its
+// files, as {"fields": {...}, "files": [...]}. Paths match from the fields.
+func (r *rules) multipart(data []byte, boundary string) []byte {
+	fields := make(map[string]any)
+	var files []fileSummary
+	mr := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			// the end of the form, or of what was captured of it
+			break
+		}
+		if part.FileName() != "" {
+			size, _ := io.Copy(io.Discard, part)
+			files = append(files, fileSummary{
+				Field:       part.FormName(),
+				Filename:    part.FileName(),
+				ContentType: part.Header.Get("Content-Type"),
+				Size:        size,
+			})
+			continue
+		}
+		value, _ := io.ReadAll(part)
+		addField(fields, part.FormName(), string(value))
+	}
+	r.Value(fields)
+
+	out, err := json.Marshal(struct {
+		Fields map[string]any `json:"fields"`
+		Files  []fileSummary  `json:"files,omitempty"`
+	}{fields, files})
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// xml redacts the text and attributes of XML elements whose name matches
+// a key rule, or whose chain of element names from the root matches a
+// path, e.g. $.Envelope.Body.Login.password or $..password. A matched
+// element is redacted with everything inside it. Input that stops part
+// way is redacted up to where it stops.
+func (r *rules) xml(data []byte) []byte {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+
+	var (
+		buf      bytes.Buffer
+		names    []string
+		matched  = -1 // depth of the outermost matched element
+		strategy Strategy
+		elements bool
+	)
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			if !elements {
+				// not XML at all
+				return []byte(r.text(string(data)))
+			}
+			return buf.Bytes()
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			elements = true
+			names = append(names, t.Name.Local)
+			if matched < 0 {
+				if st, ok := r.matchElement(names); ok {
+					matched, strategy = len(names), st
+				}
+			}
+			buf.WriteByte('<')
+			writeXMLName(&buf, t.Name)
+			for _, a := range t.Attr {
+				value := a.Value
+				if matched >= 0 {
+					value = strategy.applyString(value, r.secret)
+				} else if st, ok := r.matchKey(a.Name.Local); ok {
+					value = st.applyString(value, r.secret)
+				} else {
+					value = r.String(value)
+				}
+				buf.WriteByte(' ')
+				writeXMLName(&buf, a.Name)
+				buf.WriteString(`="`)
+				xml.EscapeText(&buf, []byte(value))
+				buf.WriteByte('"')
+			}
+			buf.WriteByte('>')
+		case xml.EndElement:
+			if len(names) > 0 {
+				if len(names) == matched {
+					matched = -1
+				}
+				names = names[:len(names)-1]
+			}
+			buf.WriteString("</")
+			writeXMLName(&buf, t.Name)
+			buf.WriteByte('>')
+		case xml.CharData:
+			text := string(t)
+			if trimmed := strings.TrimSpace(text); trimmed != "" {
+				if matched >= 0 {
+					text = strategy.applyString(trimmed, r.secret)
+				} else {
+					text = r.String(text)
+				}
+			}
+			xml.EscapeText(&buf, []byte(text))
+		case xml.Comment:
+			buf.WriteString("<!--")
+			buf.WriteString(r.String(string(t)))
+			buf.WriteString("-->")
+		case xml.ProcInst:
+			buf.WriteString("<?")
+			buf.WriteString(t.Target)
+			if len(t.Inst) > 0 {
+				buf.WriteByte(' ')
+				buf.Write(t.Inst)
+			}
+			buf.WriteString("?>")
+		case xml.Directive:
+			buf.WriteString("<!")
+			buf.Write(t)
+			buf.WriteByte('>')
+		}
+	}
+}
+
+// matchElement matches an XML element by its name, then by its chain of
+// names from the root
+func (r *rules) matchElement(names []string) (Strategy, bool) {
+	if st, ok := r.matchKey(names[len(names)-1]); ok {
+		return st, true
+	}
+	for _, pr := range r.paths {
+		if pr.path.matches(names) {
+			return pr.strategy, true
+		}
+	}
+	return Strategy{}, false
+}
+
+func writeXMLName(buf *bytes.Buffer, name xml.Name) {
+	if name.Space != "" {
+		buf.WriteString(name.Space)
+		buf.WriteByte(':')
+	}
+	buf.WriteString(name.Local)
+}
+
+// keyValuePattern finds key=value and key: value pairs in free text. The
+// value is a quoted string or runs to the next space or separator, so
+// query parameters inside a URL are pairs of their own.
+var keyValuePattern = regexp.MustCompile(`([A-Za-z0-9_.\-]+)(\s*[=:]\s*)("[^"]*"|'[^']*'|[^\s&;,?"']+)`)
+
+// text redacts the values of key=value pairs whose key matches a key
+// rule, then scans the rest with the detectors
+func (r *rules) text(s string) string {
+	if len(r.keys) > 0 {
+		s = keyValuePattern.ReplaceAllStringFunc(s, func(m string) string {
+			sub := keyValuePattern.FindStringSubmatch(m)
+			st, ok := r.matchKey(sub[1])
+			if !ok {
+				return m
+			}
+			value := sub[3]
+			if q := value[0]; (q == '"' || q == '\'') && len(value) >= 2 {
+				return sub[1] + sub[2] + string(q) + st.applyString(value[1:len(value)-1], r.secret) + string(q)
+			}
+			return sub[1] + sub[2] + st.applyString(value, r.secret)
+		})
+	}
+	return r.String(s)
+}
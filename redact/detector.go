@@ -0,0 +1,170 @@
+package redact
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Detector finds sensitive values inside free-form strings, regardless of
+// the key they are stored under. Every match is replaced with
+// [REDACTED:<label>], unless Options.Strategies has an entry for the label.
+type Detector interface {
+	// Label names what the detector finds, e.g. "email"
+	Label() string
+	// FindAll returns the [start, end) byte offsets of every match in s
+	FindAll(s string) [][]int
+}
+
+// regexDetector matches a pattern and optionally validates each match,
+// e.g. with a checksum, to cut down on false positives
+type regexDetector struct {
+	label string
+	re    *regexp.Regexp
+	valid func(match string) bool
+}
+
+// NewRegexDetector returns a Detector for a custom pattern
+func NewRegexDetector(label, pattern string) (Detector, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("kulascope: invalid detector pattern for %q: %w", label, err)
+	}
+	return &regexDetector{label: label, re: re}, nil
+}
+
+func (d *regexDetector) Label() string {
+	return d.label
+}
+
+func (d *regexDetector) FindAll(s string) [][]int {
+	locs := d.re.FindAllStringIndex(s, -1)
+	if d.valid == nil {
+		return locs
+	}
+	out := locs[:0]
+	for _, loc := range locs {
+		if d.valid(s[loc[0]:loc[1]]) {
+			out = append(out, loc)
+		}
+	}
+	return out
+}
+
+var (
+	bearerDetector = &regexDetector{label: "bearer_token", re: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`)}
+	jwtDetector    = &regexDetector{label: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)}
+	awsKeyDetector = &regexDetector{label: "aws_key", re: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`)}
+	cardDetector   = &regexDetector{label: "card", re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhnValid}
+	ibanDetector   = &regexDetector{label: "iban", re: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`), valid: ibanValid}
+	emailDetector  = &regexDetector{label: "email", re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)}
+	phoneDetector  = &regexDetector{label: "phone", re: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{2,4}\)|\b\d{2,4})[ .-]\d{3,4}[ .-]\d{3,4}\b|\+\d{8,15}\b`), valid: phoneValid}
+)
+
+// Built-in detectors
+func BearerTokenDetector() Detector { return bearerDetector }
+func JWTDetector() Detector         { return jwtDetector }
+func AWSKeyDetector() Detector      { return awsKeyDetector }
+func CardDetector() Detector        { return cardDetector }
+func IBANDetector() Detector        { return ibanDetector }
+func EmailDetector() Detector       { return emailDetector }
+func PhoneDetector() Detector       { return phoneDetector }
+
+// DefaultDetectors returns every built-in detector. Token detectors run
+// before the numeric ones so a card number is not mistaken for a phone.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		bearerDetector,
+		jwtDetector,
+		awsKeyDetector,
+		cardDetector,
+		ibanDetector,
+		emailDetector,
+		phoneDetector,
+	}
+}
+
+// scanValue replaces every detector match in s with replace(label, match)
+func scanValue(s string, detectors []Detector, replace func(label, match string) string) string {
+	for _, d := range detectors {
+		locs := d.FindAll(s)
+		if len(locs) == 0 {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, loc := range locs {
+			b.WriteString(s[last:loc[0]])
+			b.WriteString(replace(d.Label(), s[loc[0]:loc[1]]))
+			last = loc[1]
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
+
+// luhnValid checks a card number's Luhn checksum
+func luhnValid(s string) bool {
+	var sum, n int
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// phoneValid only accepts a number with a country code, an area code in
+// parentheses or at least 10 digits, so IP addresses, dates and short
+// order numbers are left alone
+func phoneValid(s string) bool {
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "(") {
+		return true
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			n++
+		}
+	}
+	return n >= 10
+}
+
+// ibanValid checks an IBAN's ISO 7064 mod 97 checksum
+func ibanValid(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	rearranged := s[4:] + s[:4]
+	var digits strings.Builder
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			fmt.Fprintf(&digits, "%d", r-'A'+10)
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	if !ok {
+		return false
+	}
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
@@ -0,0 +1,216 @@
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type stepKind int
+
+const (
+	stepName stepKind = iota
+	stepIndex
+	stepWildcard
+)
+
+// pathStep selects children of a node. With descend set it applies to the
+// node and every node below it, as in $..name.
+type pathStep struct {
+	kind    stepKind
+	name    string
+	index   int
+	descend bool
+}
+
+// jsonPath is a compiled path expression such as $.users[*].ssn,
+// $..card.number or $.items[0].token
+type jsonPath struct {
+	expr  string
+	steps []pathStep
+}
+
+// isPathExpr reports whether a redact rule is a path rather than a key name
+func isPathExpr(rule string) bool {
+	return strings.HasPrefix(strings.TrimSpace(rule), "$")
+}
+
+// compilePath parses a path expression. Supported syntax: $ root, .name,
+// ['name'], [n] (negative counts from the end), [*] and .* wildcards, and
+// .. recursive descent.
+func compilePath(expr string) (*jsonPath, error) {
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "$") {
+		return nil, errors.New("must start with $")
+	}
+
+	p := &jsonPath{expr: s}
+	i := 1
+	for i < len(s) {
+		descend := false
+		switch s[i] {
+		case '.':
+			i++
+			if i < len(s) && s[i] == '.' {
+				descend = true
+				i++
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unexpected end after '.' at offset %d", i)
+			}
+			if s[i] == '[' {
+				if !descend {
+					return nil, fmt.Errorf("unexpected '[' after '.' at offset %d", i)
+				}
+				step, next, err := parseBracket(s, i)
+				if err != nil {
+					return nil, err
+				}
+				step.descend = true
+				p.steps = append(p.steps, step)
+				i = next
+				continue
+			}
+			if s[i] == '*' {
+				p.steps = append(p.steps, pathStep{kind: stepWildcard, descend: descend})
+				i++
+				continue
+			}
+			start := i
+			for i < len(s) && s[i] != '.' && s[i] != '[' {
+				i++
+			}
+			name := s[start:i]
+			if name == "" {
+				return nil, fmt.Errorf("empty member name at offset %d", start)
+			}
+			p.steps = append(p.steps, pathStep{kind: stepName, name: name, descend: descend})
+		case '[':
+			step, next, err := parseBracket(s, i)
+			if err != nil {
+				return nil, err
+			}
+			p.steps = append(p.steps, step)
+			i = next
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", s[i], i)
+		}
+	}
+
+	if len(p.steps) == 0 {
+		return nil, errors.New("path must select at least one member")
+	}
+	return p, nil
+}
+
+// parseBracket parses [n], [*], ['name'] or ["name"] starting at s[i] == '['
+func parseBracket(s string, i int) (pathStep, int, error) {
+	end := strings.IndexByte(s[i:], ']')
+	if end < 0 {
+		return pathStep{}, 0, fmt.Errorf("unterminated '[' at offset %d", i)
+	}
+	inner := strings.TrimSpace(s[i+1 : i+end])
+	next := i + end + 1
+
+	switch {
+	case inner == "*":
+		return pathStep{kind: stepWildcard}, next, nil
+	case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+		name := inner[1 : len(inner)-1]
+		if name == "" {
+			return pathStep{}, 0, fmt.Errorf("empty member name at offset %d", i)
+		}
+		return pathStep{kind: stepName, name: name}, next, nil
+	default:
+		n, err := strconv.Atoi(inner)
+		if err != nil {
+			return pathStep{}, 0, fmt.Errorf("invalid index %q at offset %d", inner, i)
+		}
+		return pathStep{kind: stepIndex, index: n}, next, nil
+	}
+}
+
+// apply replaces every value the path selects in node with replace(value)
+func (p *jsonPath) apply(node any, replace func(any) any) {
+	p.walk(node, 0, replace)
+}
+
+func (p *jsonPath) walk(node any, i int, replace func(any) any) {
+	step := p.steps[i]
+	last := i == len(p.steps)-1
+
+	visit := func(child any, set func(any)) {
+		if last {
+			set(replace(child))
+			return
+		}
+		p.walk(child, i+1, replace)
+	}
+
+	switch v := node.(type) {
+	case map[string]any:
+		switch step.kind {
+		case stepName:
+			if child, ok := v[step.name]; ok {
+				visit(child, func(nv any) { v[step.name] = nv })
+			}
+		case stepWildcard:
+			for k, child := range v {
+				visit(child, func(nv any) { v[k] = nv })
+			}
+		}
+	case []any:
+		switch step.kind {
+		case stepIndex:
+			idx := step.index
+			if idx < 0 {
+				idx += len(v)
+			}
+			if idx >= 0 && idx < len(v) {
+				visit(v[idx], func(nv any) { v[idx] = nv })
+			}
+		case stepWildcard:
+			for j := range v {
+				visit(v[j], func(nv any) { v[j] = nv })
+			}
+		}
+	}
+
+	if !step.descend {
+		return
+	}
+	switch v := node.(type) {
+	case map[string]any:
+		for _, child := range v {
+			p.walk(child, i, replace)
+		}
+	case []any:
+		for _, child := range v {
+			p.walk(child, i, replace)
+		}
+	}
+}
+
+// matches reports whether the path selects the node reached through names,
+// a chain of member names from the root, as with nested XML elements.
+// Index steps never match.
+func (p *jsonPath) matches(names []string) bool {
+	return p.matchFrom(0, names)
+}
+
+func (p *jsonPath) matchFrom(i int, names []string) bool {
+	if i == len(p.steps) {
+		return len(names) == 0
+	}
+	if len(names) == 0 {
+		return false
+	}
+	step := p.steps[i]
+	if step.kind == stepWildcard || (step.kind == stepName && step.name == names[0]) {
+		if p.matchFrom(i+1, names[1:]) {
+			return true
+		}
+	}
+	return step.descend && p.matchFrom(i, names[1:])
+}
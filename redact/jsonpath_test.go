@@ -0,0 +1,78 @@
+package redact
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompilePathErrors(t *testing.T) {
+	for _, expr := range []string{
+		"users",
+		"$",
+		"$.",
+		"$..",
+		"$.users.[0]",
+		"$.users[0",
+		"$.users[x]",
+		"$['']",
+		"$.a..",
+		"$users",
+	} {
+		if _, err := compilePath(expr); err == nil {
+			t.Errorf("compilePath(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestJSONPathApply(t *testing.T) {
+	const doc = `{"users":[{"ssn":"1","card":{"number":"4111"}},{"ssn":"2"}],"items":[{"token":"a"},{"token":"b"}],"meta":{"ssn":"3"}}`
+	for _, tc := range []struct {
+		expr, want string
+	}{
+		{"$.users[*].ssn", `{"users":[{"ssn":"X","card":{"number":"4111"}},{"ssn":"X"}],"items":[{"token":"a"},{"token":"b"}],"meta":{"ssn":"3"}}`},
+		{"$..ssn", `{"users":[{"ssn":"X","card":{"number":"4111"}},{"ssn":"X"}],"items":[{"token":"a"},{"token":"b"}],"meta":{"ssn":"X"}}`},
+		{"$..card.number", `{"users":[{"ssn":"1","card":{"number":"X"}},{"ssn":"2"}],"items":[{"token":"a"},{"token":"b"}],"meta":{"ssn":"3"}}`},
+		{"$.items[0].token", `{"users":[{"ssn":"1","card":{"number":"4111"}},{"ssn":"2"}],"items":[{"token":"X"},{"token":"b"}],"meta":{"ssn":"3"}}`},
+		{"$.items[-1].token", `{"users":[{"ssn":"1","card":{"number":"4111"}},{"ssn":"2"}],"items":[{"token":"a"},{"token":"X"}],"meta":{"ssn":"3"}}`},
+		{"$.items[5].token", doc},
+		{"$['meta'].*", `{"users":[{"ssn":"1","card":{"number":"4111"}},{"ssn":"2"}],"items":[{"token":"a"},{"token":"b"}],"meta":{"ssn":"X"}}`},
+		{"$.missing.ssn", doc},
+	} {
+		p, err := compilePath(tc.expr)
+		if err != nil {
+			t.Fatalf("compilePath(%q): %v", tc.expr, err)
+		}
+		var node, want any
+		json.Unmarshal([]byte(doc), &node)
+		json.Unmarshal([]byte(tc.want), &want)
+		p.apply(node, func(any) any { return "X" })
+		got, _ := json.Marshal(node)
+		wantJSON, _ := json.Marshal(want)
+		if string(got) != string(wantJSON) {
+			t.Errorf("%s:\n got  %s\n want %s", tc.expr, got, wantJSON)
+		}
+	}
+}
+
+func TestJSONPathMatches(t *testing.T) {
+	for _, tc := range []struct {
+		expr  string
+		names []string
+		want  bool
+	}{
+		{"$.Envelope.Body.password", []string{"Envelope", "Body", "password"}, true},
+		{"$.Envelope.Body.password", []string{"Envelope", "password"}, false},
+		{"$..password", []string{"Envelope", "Body", "password"}, true},
+		{"$..password", []string{"password", "hint"}, false},
+		{"$.Envelope.*.password", []string{"Envelope", "Header", "password"}, true},
+		{"$.items[0]", []string{"items", "0"}, false},
+	} {
+		p, err := compilePath(tc.expr)
+		if err != nil {
+			t.Fatalf("compilePath(%q): %v", tc.expr, err)
+		}
+		if got := p.matches(tc.names); got != tc.want {
+			t.Errorf("%s matches %v = %v, want %v", tc.expr, tc.names, got, tc.want)
+		}
+	}
+}
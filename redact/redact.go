@@ -0,0 +1,371 @@
+// Package redact is the rule engine behind every redaction the SDK does:
+// captured headers and bodies, query strings, sub-log metadata and the
+// stdout log lines. Rules are key names or path expressions, optionally
+// backed by value detectors and per-rule replacement strategies.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// KeyMatchMode controls how key-name rules are compared to keys
+type KeyMatchMode string
+
+const (
+	// KeyMatchSubstring redacts keys containing the rule, or contained in it,
+	// e.g. "token" matches "access_token" and "password" matches "pass".
+	// This is the default.
+	KeyMatchSubstring KeyMatchMode = "substring"
+	// KeyMatchExact redacts keys equal to the rule, ignoring case, so "pass"
+	// no longer matches "passport_number"
+	KeyMatchExact KeyMatchMode = "exact"
+)
+
+// Replacement is what FullRedact writes in place of a value
+const Replacement = "[CLIENT_REDACTED]"
+
+var (
+	// DefaultBodyKeys are always redacted from bodies and sub-log metadata
+	DefaultBodyKeys = []string{"password", "secret", "token"}
+	// DefaultHeaderKeys are always redacted from headers
+	DefaultHeaderKeys = []string{"authorization", "cookie"}
+)
+
+// Redactor applies one compiled rule set
+type Redactor interface {
+	// JSON redacts a JSON document. A document that was cut off, such as a
+	// truncated body, is closed after its last complete value first.
+	// Non-JSON input is only scanned by the detectors.
+	JSON(data []byte) []byte
+	// Body redacts a body by its content type: url-encoded and multipart
+	// forms, XML and plain-text key=value pairs get the same rules as
+	// JSON. Files in a multipart form are summarized by name, size and
+	// type instead of kept. Anything else goes through JSON.
+	Body(data []byte, contentType string) []byte
+	// Value redacts a decoded JSON value in place. The result only differs
+	// from v when v itself is a string.
+	Value(v any) any
+	// Headers redacts header values in place
+	Headers(h map[string][]string) map[string][]string
+	// URL redacts query parameter values, including those in a
+	// key=value fragment, and any password in the user info
+	URL(rawURL string) string
+	// Query redacts a raw query string into a map of its parameters.
+	// Repeated parameters become lists.
+	Query(rawQuery string) map[string]any
+	// Metadata redacts log fields in place. Paths match from the fields as
+	// a whole and from each field's value, so a body logged under any key
+	// is redacted like the captured body.
+	Metadata(m map[string]any) map[string]any
+	// String masks detector matches in a free-form string
+	String(s string) string
+}
+
+// Options configures a rule set
+type Options struct {
+	// Rules are key names, or path expressions starting with $
+	Rules []string
+	// KeyMatch controls how key-name rules match (default KeyMatchSubstring)
+	KeyMatch KeyMatchMode
+	// Detectors scan string values the rules leave alone
+	Detectors []Detector
+	// Strategies replace matches per rule or detector label; anything not
+	// listed uses FullRedact
+	Strategies map[string]Strategy
+	// Secret keys Pseudonymize
+	Secret []byte
+	// ExactFields matches key rules exactly against the top-level keys
+	// given to Metadata, whatever KeyMatch says. Log lines use it: their
+	// field names are the application's own, e.g. tokens_used.
+	ExactFields bool
+}
+
+// rules is the Redactor implementation
+type rules struct {
+	keys        []keyRule
+	paths       []pathRule
+	exact       bool
+	exactFields bool
+	detectors   []Detector
+	labels      map[string]Strategy // detector label -> strategy
+	secret      []byte
+}
+
+type keyRule struct {
+	name     string // lowercased
+	strategy Strategy
+}
+
+type pathRule struct {
+	path     *jsonPath
+	strategy Strategy
+}
+
+// Compile builds a Redactor. It fails on an invalid path expression or a
+// strategy that cannot be applied.
+func Compile(opts Options) (Redactor, error) {
+	r := &rules{
+		exact:       opts.KeyMatch == KeyMatchExact,
+		exactFields: opts.ExactFields,
+		detectors:   opts.Detectors,
+		secret:      opts.Secret,
+	}
+	for rule, st := range opts.Strategies {
+		if err := st.validate(opts.Secret); err != nil {
+			return nil, fmt.Errorf("kulascope: strategy for %q %w", rule, err)
+		}
+	}
+	for _, d := range opts.Detectors {
+		if st, ok := opts.Strategies[d.Label()]; ok {
+			if r.labels == nil {
+				r.labels = make(map[string]Strategy)
+			}
+			r.labels[d.Label()] = st
+		}
+	}
+	for _, rule := range opts.Rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if IsPath(rule) {
+			p, err := compilePath(rule)
+			if err != nil {
+				return nil, fmt.Errorf("kulascope: invalid redact path %q: %w", rule, err)
+			}
+			r.paths = append(r.paths, pathRule{path: p, strategy: strategyFor(opts.Strategies, rule)})
+			continue
+		}
+		r.keys = append(r.keys, keyRule{name: strings.ToLower(rule), strategy: strategyFor(opts.Strategies, rule)})
+	}
+	return r, nil
+}
+
+// Lenient is like Compile but skips invalid paths and strategies instead
+// of failing
+func Lenient(opts Options) Redactor {
+	base := opts
+	base.Rules = nil
+	r, err := Compile(base)
+	if err != nil {
+		base.Strategies = nil
+		r, _ = Compile(base)
+	}
+	lr := r.(*rules)
+	for _, rule := range opts.Rules {
+		one := base
+		one.Rules = []string{rule}
+		if c, err := Compile(one); err == nil {
+			lr.keys = append(lr.keys, c.(*rules).keys...)
+			lr.paths = append(lr.paths, c.(*rules).paths...)
+		}
+	}
+	return lr
+}
+
+// IsPath reports whether a rule is a path expression rather than a key name
+func IsPath(rule string) bool {
+	return isPathExpr(rule)
+}
+
+// matchKey reports whether a key name is covered by the key rules, and
+// with which strategy. An exact match wins over a substring match.
+func (r *rules) matchKey(key string) (Strategy, bool) {
+	return r.match(key, r.exact)
+}
+
+// match is matchKey with the match mode given
+func (r *rules) match(key string, exact bool) (Strategy, bool) {
+	keyLower := strings.ToLower(strings.TrimSpace(key))
+	var found *keyRule
+	for i, rule := range r.keys {
+		if keyLower == rule.name {
+			return rule.strategy, true
+		}
+		if found == nil && !exact && keyLower != "" &&
+			(strings.Contains(keyLower, rule.name) || strings.Contains(rule.name, keyLower)) {
+			found = &r.keys[i]
+		}
+	}
+	if found == nil {
+		return Strategy{}, false
+	}
+	return found.strategy, true
+}
+
+func (r *rules) JSON(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+
+	var src any
+	if err := json.Unmarshal(data, &src); err != nil {
+		completed, ok := completeJSON(data)
+		if !ok || json.Unmarshal(completed, &src) != nil {
+			if len(r.detectors) > 0 {
+				return []byte(r.String(string(data)))
+			}
+			return data
+		}
+	}
+
+	src = r.Value(src)
+
+	out, err := json.Marshal(src)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+func (r *rules) Value(node any) any {
+	r.applyPaths(node)
+	return r.redactKeys(node)
+}
+
+// applyPaths redacts what the path rules match from node
+func (r *rules) applyPaths(node any) {
+	for _, pr := range r.paths {
+		pr.path.apply(node, func(v any) any { return pr.strategy.apply(v, r.secret) })
+	}
+}
+
+func (r *rules) Metadata(m map[string]any) map[string]any {
+	for _, pr := range r.paths {
+		if pr.path.steps[0].descend {
+			continue // already reaches every field from the root
+		}
+		for _, v := range m {
+			pr.path.apply(v, func(v any) any { return pr.strategy.apply(v, r.secret) })
+		}
+	}
+	r.applyPaths(m)
+	r.redactKeysMatching(m, r.exact || r.exactFields)
+	return m
+}
+
+// redactKeys redacts by key name and returns the (possibly replaced) node
+func (r *rules) redactKeys(node any) any {
+	return r.redactKeysMatching(node, r.exact)
+}
+
+// redactKeysMatching is redactKeys with the match mode given for the keys
+// of node itself; nested keys use the configured mode
+func (r *rules) redactKeysMatching(node any, exact bool) any {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, val := range v {
+			// if the key matches the redact rules, replace the value
+			if st, ok := r.match(key, exact); ok {
+				v[key] = st.apply(val, r.secret)
+				continue
+			}
+
+			// If the value is a string that *looks like* JSON, try to parse and redact inside it
+			if s, ok := val.(string); ok {
+				ts := strings.TrimSpace(s)
+				if len(ts) > 0 && (ts[0] == '{' || ts[0] == '[') {
+					var nested any
+					if err := json.Unmarshal([]byte(ts), &nested); err == nil {
+						nested = r.redactKeys(nested)
+						if b, err := json.Marshal(nested); err == nil {
+							v[key] = string(b)
+							continue
+						}
+					}
+				}
+			}
+
+			// Otherwise recurse normally
+			v[key] = r.redactKeys(val)
+		}
+
+	case []any:
+		for i := range v {
+			v[i] = r.redactKeys(v[i])
+		}
+
+	case []string:
+		for i := range v {
+			v[i] = r.String(v[i])
+		}
+
+	case string:
+		return r.String(v)
+	}
+	return node
+}
+
+func (r *rules) String(s string) string {
+	if len(r.detectors) == 0 {
+		return s
+	}
+	return scanValue(s, r.detectors, r.replaceMatch)
+}
+
+// replaceMatch returns the replacement for a detector match
+func (r *rules) replaceMatch(label, match string) string {
+	if st, ok := r.labels[label]; ok && st.kind != strategyRedact {
+		return st.applyString(match, r.secret)
+	}
+	return "[REDACTED:" + label + "]"
+}
+
+// replaceAll applies a strategy to every value of a header or query parameter
+func (r *rules) replaceAll(st Strategy, values []string) []string {
+	if st.kind == strategyRedact {
+		return []string{Replacement}
+	}
+	for i, v := range values {
+		values[i] = st.applyString(v, r.secret)
+	}
+	return values
+}
+
+func (r *rules) Headers(headers map[string][]string) map[string][]string {
+	for k := range headers {
+		if st, ok := r.matchKey(k); ok {
+			headers[k] = r.replaceAll(st, headers[k])
+			continue
+		}
+		for i, v := range headers[k] {
+			headers[k][i] = r.String(v)
+		}
+	}
+	return headers
+}
+
+func (r *rules) URL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return r.text(rawURL)
+	}
+	changed := false
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Replacement)
+		changed = true
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = string(r.form([]byte(u.RawQuery)))
+		changed = true
+	}
+	if strings.Contains(u.Fragment, "=") {
+		// e.g. #access_token=... from an OAuth redirect
+		u.RawFragment = string(r.form([]byte(u.EscapedFragment())))
+		u.Fragment, _ = url.PathUnescape(u.RawFragment)
+		changed = true
+	}
+	if !changed {
+		return rawURL
+	}
+	return u.String()
+}
+
+func (r *rules) Query(rawQuery string) map[string]any {
+	_, fields := parseForm(rawQuery)
+	r.Value(fields)
+	return fields
+}
@@ -0,0 +1,55 @@
+package redact
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchKey(t *testing.T) {
+	for _, tc := range []struct {
+		mode KeyMatchMode
+		rule string
+		key  string
+		want bool
+	}{
+		{KeyMatchSubstring, "password", "password", true},
+		{KeyMatchSubstring, "token", "access_token", true},
+		{KeyMatchSubstring, "password", "pass", true},
+		{KeyMatchSubstring, "password", "PASS", true},
+		{KeyMatchSubstring, "password", "user", false},
+		{KeyMatchSubstring, "password", "", false},
+		{KeyMatchExact, "pass", "Pass", true},
+		{KeyMatchExact, "pass", "passport_number", false},
+		{KeyMatchExact, "password", "pass", false},
+	} {
+		r, err := Compile(Options{Rules: []string{tc.rule}, KeyMatch: tc.mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, got := r.(*rules).matchKey(tc.key); got != tc.want {
+			t.Errorf("%s rule %q, key %q: matched = %v, want %v", tc.mode, tc.rule, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestExactFields(t *testing.T) {
+	r, err := Compile(Options{Rules: DefaultBodyKeys, ExactFields: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := r.Metadata(map[string]any{
+		"tokens_used": 12,
+		"token":       "t",
+		"body":        map[string]any{"access_token": "a", "name": "n"},
+		"raw":         `{"secret_key":"s"}`,
+	})
+	want := map[string]any{
+		"tokens_used": 12,
+		"token":       Replacement,
+		"body":        map[string]any{"access_token": Replacement, "name": "n"},
+		"raw":         `{"secret_key":"[CLIENT_REDACTED]"}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
@@ -0,0 +1,153 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type strategyKind int
+
+const (
+	strategyRedact strategyKind = iota
+	strategyMask
+	strategyHMAC
+	strategyTruncate
+)
+
+// Strategy decides how a value matched by a redact rule is replaced.
+// The zero value fully redacts.
+type Strategy struct {
+	kind  strategyKind
+	keep  int
+	plain bool // Truncate without the ellipsis
+}
+
+// FullRedact replaces the value with [CLIENT_REDACTED]
+func FullRedact() Strategy {
+	return Strategy{kind: strategyRedact}
+}
+
+// PartialMask replaces every character except the last keepLast with *,
+// e.g. PartialMask(4) turns 4111111111111111 into ************1111. Values
+// no longer than keepLast are masked entirely.
+func PartialMask(keepLast int) Strategy {
+	return Strategy{kind: strategyMask, keep: keepLast}
+}
+
+// Pseudonymize replaces the value with a keyed HMAC-SHA256 of it, so equal
+// values can still be correlated across requests. The key is
+// Options.Secret (Config.RedactSecret), which never leaves the process.
+func Pseudonymize() Strategy {
+	return Strategy{kind: strategyHMAC}
+}
+
+// Truncate keeps the first keep characters and drops the rest, e.g.
+// Truncate(3) turns 94107 into 941…
+func Truncate(keep int) Strategy {
+	return Strategy{kind: strategyTruncate, keep: keep}
+}
+
+// TruncatePlain is Truncate without the ellipsis, so the result keeps the
+// value's format, e.g. TruncatePlain(3) turns 94107 into 941
+func TruncatePlain(keep int) Strategy {
+	return Strategy{kind: strategyTruncate, keep: keep, plain: true}
+}
+
+// apply returns the replacement for v. Values that cannot be masked or
+// truncated, such as objects, are fully redacted.
+func (s Strategy) apply(v any, secret []byte) any {
+	if s.kind == strategyRedact {
+		return Replacement
+	}
+
+	str, ok := stringify(v)
+	if !ok {
+		if s.kind != strategyHMAC {
+			return Replacement
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return Replacement
+		}
+		str = string(b)
+	}
+	return s.applyString(str, secret)
+}
+
+func (s Strategy) applyString(str string, secret []byte) string {
+	switch s.kind {
+	case strategyMask:
+		runes := []rune(str)
+		keep := max(s.keep, 0)
+		if keep >= len(runes) {
+			// nothing would be hidden
+			keep = 0
+		}
+		return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+	case strategyHMAC:
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(str))
+		return "hmac:" + hex.EncodeToString(mac.Sum(nil))
+	case strategyTruncate:
+		runes := []rune(str)
+		if len(runes) <= s.keep {
+			return str
+		}
+		if s.plain {
+			return string(runes[:max(s.keep, 0)])
+		}
+		return string(runes[:max(s.keep, 0)]) + "…"
+	default:
+		return Replacement
+	}
+}
+
+// stringify renders scalar JSON values as strings
+func stringify(v any) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, true
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), true
+	case json.Number:
+		return val.String(), true
+	case bool, int, int64:
+		return fmt.Sprint(val), true
+	default:
+		return "", false
+	}
+}
+
+// strategyFor looks up the strategy for a rule. Key names compare
+// case-insensitively, paths exactly.
+func strategyFor(strategies map[string]Strategy, rule string) Strategy {
+	if st, ok := strategies[rule]; ok {
+		return st
+	}
+	if isPathExpr(rule) {
+		return Strategy{}
+	}
+	for k, st := range strategies {
+		if strings.EqualFold(k, rule) {
+			return st
+		}
+	}
+	return Strategy{}
+}
+
+// validate rejects a strategy that cannot be applied
+func (s Strategy) validate(secret []byte) error {
+	if s.kind == strategyHMAC && len(secret) == 0 {
+		return errors.New("needs a secret (Config.RedactSecret)")
+	}
+	if s.keep < 0 {
+		return errors.New("keeps a negative length")
+	}
+	return nil
+}
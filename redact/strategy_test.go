@@ -0,0 +1,67 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStrategyApply(t *testing.T) {
+	secret := []byte("s3cret")
+	for _, tc := range []struct {
+		name string
+		st   Strategy
+		in   any
+		want any
+	}{
+		{"redact", FullRedact(), "4111111111111111", Replacement},
+		{"redact empty", FullRedact(), "", Replacement},
+
+		{"mask", PartialMask(4), "4111111111111111", "************1111"},
+		{"mask number", PartialMask(2), float64(94107), "***07"},
+		{"mask multi-byte", PartialMask(2), "Zoë Ösel", "******el"},
+		{"mask as long as keep", PartialMask(4), "1234", "****"},
+		{"mask shorter than keep", PartialMask(4), "12", "**"},
+		{"mask empty", PartialMask(4), "", ""},
+		{"mask object", PartialMask(4), map[string]any{"a": "b"}, Replacement},
+
+		{"truncate", Truncate(3), "94107", "941…"},
+		{"truncate multi-byte", Truncate(2), "日本語テキスト", "日本…"},
+		{"truncate short", Truncate(3), "941", "941"},
+		{"truncate empty", Truncate(3), "", ""},
+		{"truncate plain", TruncatePlain(3), "94107", "941"},
+		{"truncate plain multi-byte", TruncatePlain(1), "Ölfeld", "Ö"},
+		{"truncate plain short", TruncatePlain(8), "94107", "94107"},
+		{"truncate object", Truncate(3), []any{"a"}, Replacement},
+	} {
+		if got := tc.st.apply(tc.in, secret); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPseudonymize(t *testing.T) {
+	st := Pseudonymize()
+	a := st.apply("jane@example.com", []byte("k1"))
+	if a != st.apply("jane@example.com", []byte("k1")) {
+		t.Error("same value and key hashed differently")
+	}
+	if a == st.apply("jane@example.com", []byte("k2")) {
+		t.Error("different keys hashed alike")
+	}
+	if s := a.(string); !strings.HasPrefix(s, "hmac:") || len(s) != len("hmac:")+64 {
+		t.Errorf("got %q, want hmac: and a hex SHA-256", s)
+	}
+	if empty := st.apply("", []byte("k1")); empty == "" || empty == a {
+		t.Errorf("empty value hashed to %q", empty)
+	}
+	if obj := st.apply(map[string]any{"a": 1.0}, []byte("k1")).(string); !strings.HasPrefix(obj, "hmac:") {
+		t.Errorf("object hashed to %q", obj)
+	}
+
+	if _, err := Compile(Options{Rules: []string{"email"}, Strategies: map[string]Strategy{"email": st}}); err == nil {
+		t.Error("Compile accepted Pseudonymize without a secret")
+	}
+	if _, err := Compile(Options{Strategies: map[string]Strategy{"zip": Truncate(-1)}}); err == nil {
+		t.Error("Compile accepted a negative length")
+	}
+}
@@ -0,0 +1,190 @@
+package redact
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// JSON scanner states
+const (
+	wantValue = iota // a value, or ] right after [
+	wantKey          // a key, or } right after {
+	wantColon
+	wantComma // a comma or the closing bracket
+	wantEnd   // the document is complete
+)
+
+// completeJSON closes a JSON document that was cut off, e.g. a truncated
+// body, so it can be parsed and redacted. The member or element left
+// incomplete is dropped, except a string value, which keeps what it has.
+// ok is false when data is not the start of a JSON document.
+func completeJSON(data []byte) (_ []byte, ok bool) {
+	var (
+		stack     []byte // open brackets
+		state     = wantValue
+		empty     bool // the innermost container has nothing in it yet
+		safe      int  // where the last complete value ends
+		safeDepth int  // len(stack) at safe; nothing is popped past it
+		inString  bool
+		isKey     bool
+		escape    int // -1 right after a backslash, then the hex digits left
+		strSafe   int // where the last complete character in the string ends
+		scalar    = -1
+	)
+	done := func(end int) {
+		if len(stack) == 0 {
+			state = wantEnd
+		} else {
+			state = wantComma
+		}
+		safe, safeDepth = end, len(stack)
+	}
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			switch {
+			case escape == -1:
+				switch c {
+				case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+					escape = 0
+				case 'u':
+					escape = 4
+				default:
+					return nil, false
+				}
+			case escape > 0:
+				if !isHex(c) {
+					return nil, false
+				}
+				escape--
+			case c == '\\':
+				escape = -1
+				continue
+			case c == '"':
+				inString = false
+				if isKey {
+					state = wantColon
+				} else {
+					done(i + 1)
+				}
+				continue
+			case c < 0x20:
+				return nil, false
+			}
+			if escape == 0 {
+				strSafe = i + 1
+			}
+			continue
+		}
+		if scalar >= 0 {
+			if isScalarByte(c) {
+				continue
+			}
+			if !json.Valid(data[scalar:i]) {
+				return nil, false
+			}
+			scalar = -1
+			done(i)
+		}
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			continue
+		}
+
+		switch state {
+		case wantValue:
+			switch {
+			case c == '{' || c == '[':
+				stack = append(stack, c)
+				state, empty = wantKey, true
+				if c == '[' {
+					state = wantValue
+				}
+				safe, safeDepth = i+1, len(stack)
+				continue
+			case c == ']' && empty && len(stack) > 0 && stack[len(stack)-1] == '[':
+				stack = stack[:len(stack)-1]
+				done(i + 1)
+			case c == '"':
+				inString, isKey, strSafe = true, false, i+1
+			case c == '-' || (c >= '0' && c <= '9') || c == 't' || c == 'f' || c == 'n':
+				scalar = i
+			default:
+				return nil, false
+			}
+		case wantKey:
+			switch {
+			case c == '"':
+				inString, isKey = true, true
+			case c == '}' && empty:
+				stack = stack[:len(stack)-1]
+				done(i + 1)
+			default:
+				return nil, false
+			}
+		case wantColon:
+			if c != ':' {
+				return nil, false
+			}
+			state = wantValue
+		case wantComma:
+			top := stack[len(stack)-1]
+			switch {
+			case c == ',' && top == '{':
+				state = wantKey
+			case c == ',':
+				state = wantValue
+			case (c == '}' && top == '{') || (c == ']' && top == '['):
+				stack = stack[:len(stack)-1]
+				done(i + 1)
+				continue
+			default:
+				return nil, false
+			}
+		case wantEnd:
+			return nil, false
+		}
+		empty = false
+	}
+
+	var out []byte
+	switch {
+	case inString && !isKey:
+		// keep the partial string, without half a UTF-8 sequence
+		out = trimPartialRune(append([]byte(nil), data[:strSafe]...))
+		out = append(out, '"')
+	case len(stack) == 0 && safeDepth == 0 && state != wantEnd:
+		return nil, false
+	default:
+		out = append([]byte(nil), data[:safe]...)
+		stack = stack[:safeDepth]
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == '{' {
+			out = append(out, '}')
+		} else {
+			out = append(out, ']')
+		}
+	}
+	return out, true
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence from the end of b
+func trimPartialRune(b []byte) []byte {
+	for len(b) > 0 {
+		if r, size := utf8.DecodeLastRune(b); r != utf8.RuneError || size != 1 {
+			break
+		}
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// isScalarByte reports whether c can appear in a number or literal
+func isScalarByte(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || c == '-' || c == '+' || c == '.' || c == 'E'
+}
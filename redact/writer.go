@@ -0,0 +1,86 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+var errNotObject = errors.New("not a JSON object")
+
+// NewWriter returns a writer that redacts each JSON log line, as zerolog
+// writes them, before passing it on to w. Field order is kept. Lines that
+// are not JSON objects are only scanned by the detectors.
+func NewWriter(w io.Writer, r Redactor) io.Writer {
+	return &writer{w: w, r: r}
+}
+
+type writer struct {
+	w io.Writer
+	r Redactor
+}
+
+func (rw *writer) Write(p []byte) (int, error) {
+	out, err := redactLine(p, rw.r)
+	if err != nil {
+		out = []byte(rw.r.String(string(p)))
+	}
+	if _, err := rw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// redactLine redacts one field at a time so the line keeps its order
+func redactLine(p []byte, r Redactor) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errNotObject
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		var val any
+		if err := dec.Decode(&val); err != nil {
+			return nil, err
+		}
+
+		field := map[string]any{key: val}
+		r.Metadata(field)
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		if err := encode(&buf, key); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		if err := encode(&buf, field[key]); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// encode writes v as JSON without HTML escaping, matching zerolog
+func encode(buf *bytes.Buffer, v any) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1) // Encode appends a newline
+	return nil
+}
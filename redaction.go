@@ -0,0 +1,66 @@
+package kulascope
+
+import "github.com/kulawise/kulascope-go-sdk/redact"
+
+// KeyMatchMode controls how key-name redact rules are compared to keys
+type KeyMatchMode = redact.KeyMatchMode
+
+const (
+	// KeyMatchSubstring redacts keys containing the rule, or contained in it,
+	// e.g. "token" matches "access_token" and "password" matches "pass".
+	// This is the default.
+	KeyMatchSubstring = redact.KeyMatchSubstring
+	// KeyMatchExact redacts keys equal to the rule, ignoring case, so "pass"
+	// no longer matches "passport_number"
+	KeyMatchExact = redact.KeyMatchExact
+)
+
+// Strategy decides how a value matched by a redact rule is replaced.
+// The zero value fully redacts.
+type Strategy = redact.Strategy
+
+// FullRedact replaces the value with [CLIENT_REDACTED]
+func FullRedact() Strategy { return redact.FullRedact() }
+
+// PartialMask replaces every character except the last keepLast with *,
+// e.g. PartialMask(4) turns 4111111111111111 into ************1111. Values
+// no longer than keepLast are masked entirely.
+func PartialMask(keepLast int) Strategy { return redact.PartialMask(keepLast) }
+
+// Pseudonymize replaces the value with a keyed HMAC-SHA256 of it, so equal
+// values can still be correlated across requests. The key is
+// Config.RedactSecret, which never leaves the process.
+func Pseudonymize() Strategy { return redact.Pseudonymize() }
+
+// Truncate keeps the first keep characters and drops the rest, e.g.
+// Truncate(3) turns 94107 into 941…
+func Truncate(keep int) Strategy { return redact.Truncate(keep) }
+
+// TruncatePlain is Truncate without the ellipsis, so the result keeps the
+// value's format, e.g. TruncatePlain(3) turns 94107 into 941
+func TruncatePlain(keep int) Strategy { return redact.TruncatePlain(keep) }
+
+// compileRules compiles one of the config's redact lists with its shared
+// match mode, detectors and strategies
+func compileRules(list []string, cfg Config) (redact.Redactor, error) {
+	return redact.Compile(redactOptions(list, cfg))
+}
+
+// compileLogRules compiles the request body rules for the stdout log lines,
+// whose own field names, e.g. tokens_used or author, only match a key rule
+// exactly
+func compileLogRules(cfg Config) (redact.Redactor, error) {
+	opts := redactOptions(cfg.RedactRequestBody, cfg)
+	opts.ExactFields = true
+	return redact.Compile(opts)
+}
+
+func redactOptions(list []string, cfg Config) redact.Options {
+	return redact.Options{
+		Rules:      list,
+		KeyMatch:   cfg.RedactKeyMatch,
+		Detectors:  cfg.Detectors,
+		Strategies: cfg.RedactStrategies,
+		Secret:     cfg.RedactSecret,
+	}
+}
@@ -0,0 +1,223 @@
+package kulascope
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy controls how a failed batch is retried. Backoff uses full
+// jitter: each wait is random between zero and InitialBackoff doubled per
+// attempt, capped at MaxBackoff.
+type RetryPolicy struct {
+	// MaxRetries is how many times a batch is retried after the first
+	// attempt (default 5); a negative value disables retries
+	MaxRetries int
+	// InitialBackoff is the backoff cap for the first retry (default 1s)
+	InitialBackoff time.Duration
+	// MaxBackoff caps every wait, including a server's Retry-After
+	// (default 30s)
+	MaxBackoff time.Duration
+}
+
+func (p *RetryPolicy) setDefaults() {
+	if p.MaxRetries == 0 {
+		p.MaxRetries = 5
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = time.Second
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 30 * time.Second
+	}
+}
+
+// backoff returns the wait before retry number attempt+1
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	limit := p.MaxBackoff
+	if attempt < 32 {
+		limit = min(p.InitialBackoff<<attempt, p.MaxBackoff)
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit + 1)
+}
+
+// HTTPError is returned by the HTTP exporters for a non-2xx response
+type HTTPError struct {
+	StatusCode int
+	// RetryAfter is the server's requested delay, from Retry-After
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("server responded %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Retryable reports whether the request may succeed if sent again:
+// timeouts, rate limits and server errors. Other 4xx responses, e.g. 400,
+// 401 or 413, mean the batch itself was rejected.
+func (e *HTTPError) Retryable() bool {
+	return e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode >= 500
+}
+
+// newHTTPError builds the error for a non-2xx response
+func newHTTPError(resp *http.Response) *HTTPError {
+	e := &HTTPError{StatusCode: resp.StatusCode}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+	return e
+}
+
+// parseRetryAfter accepts delay-seconds or an HTTP date
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// permanentError marks an error that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error returned by a custom Exporter so the batch is
+// not retried and goes straight to the dead-letter sink
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// partialError reports that part of a batch was delivered. Retries call
+// rest, which sends only what is left; without rest there is nothing to
+// retry. Giving up dead-letters only undelivered, so that a replay does not
+// send the delivered part again, and counts lost more records as failed
+// that cannot be replayed on their own, e.g. spans a collector rejected
+// without saying which.
+type partialError struct {
+	err         error
+	rest        func(context.Context) error
+	undelivered []CreateLogRequest
+	lost        int
+}
+
+func (e *partialError) Error() string { return e.err.Error() }
+func (e *partialError) Unwrap() error { return e.err }
+
+// undelivered returns the records of a batch to dead-letter after err, and
+// how many of the batch's records were not delivered
+func undelivered(records []CreateLogRequest, err error) ([]CreateLogRequest, int) {
+	var partial *partialError
+	if errors.As(err, &partial) {
+		return partial.undelivered, min(len(partial.undelivered)+partial.lost, len(records))
+	}
+	return records, len(records)
+}
+
+// retryable reports whether err may go away on retry, and how long the
+// server asked to wait
+func retryable(err error) (bool, time.Duration) {
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return false, 0
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Retryable(), httpErr.RetryAfter
+	}
+	return true, 0
+}
+
+// exportStats counts export attempts across a client's sender workers
+type exportStats struct {
+	attempts atomic.Int64
+	retries  atomic.Int64
+	errors   atomic.Int64
+	nanos    atomic.Int64
+}
+
+// retrier exports batches per a retry policy, through an optional circuit
+// breaker, optionally counting attempts
+type retrier struct {
+	policy  RetryPolicy
+	breaker *breaker
+	stats   *exportStats
+}
+
+// export calls Export until it succeeds, the error is not retryable or
+// the policy is exhausted, and returns the last error. After a partial
+// error only the undelivered part is retried. With a breaker,
+// each attempt first waits for it to let the call through; the wait does
+// not count as a retry.
+func (r retrier) export(ctx context.Context, e Exporter, records []CreateLogRequest) error {
+	send := func(ctx context.Context) error { return e.Export(ctx, records) }
+	var err error
+	for attempt := 0; ; attempt++ {
+		if r.breaker != nil {
+			if waitErr := r.breaker.acquire(ctx); waitErr != nil {
+				return cmp.Or(err, waitErr)
+			}
+		}
+		start := time.Now()
+		err = send(ctx)
+		if r.stats != nil {
+			r.stats.attempts.Add(1)
+			r.stats.nanos.Add(int64(time.Since(start)))
+			if attempt > 0 {
+				r.stats.retries.Add(1)
+			}
+			if err != nil {
+				r.stats.errors.Add(1)
+			}
+		}
+		ok, retryAfter := retryable(err)
+		if r.breaker != nil {
+			// a rejected batch still means the ingest API is up
+			r.breaker.record(err == nil || !ok)
+		}
+		if err == nil {
+			return nil
+		}
+		var partial *partialError
+		if errors.As(err, &partial) && partial.rest != nil {
+			send = partial.rest
+		}
+		if !ok || attempt >= r.policy.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		wait := r.policy.backoff(attempt)
+		if retryAfter > 0 {
+			wait = min(retryAfter, r.policy.MaxBackoff)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package kulascope
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		err   error
+		want  bool
+		after time.Duration
+	}{
+		{"network error", errors.New("connection refused"), true, 0},
+		{"408", &HTTPError{StatusCode: http.StatusRequestTimeout}, true, 0},
+		{"429 with Retry-After", &HTTPError{StatusCode: http.StatusTooManyRequests, RetryAfter: 3 * time.Second}, true, 3 * time.Second},
+		{"500", &HTTPError{StatusCode: http.StatusInternalServerError}, true, 0},
+		{"wrapped 503", fmt.Errorf("otlp /v1/logs: %w", &HTTPError{StatusCode: http.StatusServiceUnavailable}), true, 0},
+		{"400", &HTTPError{StatusCode: http.StatusBadRequest}, false, 0},
+		{"401", &HTTPError{StatusCode: http.StatusUnauthorized}, false, 0},
+		{"413", &HTTPError{StatusCode: http.StatusRequestEntityTooLarge}, false, 0},
+		{"permanent", Permanent(errors.New("bad record")), false, 0},
+		{"permanent 503", Permanent(&HTTPError{StatusCode: http.StatusServiceUnavailable}), false, 0},
+	} {
+		ok, after := retryable(tc.err)
+		if ok != tc.want || after != tc.after {
+			t.Errorf("%s: retryable = %v, %v; want %v, %v", tc.name, ok, after, tc.want, tc.after)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 50 * time.Second, time.Minute},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	} {
+		if got := parseRetryAfter(tc.value); got < tc.min || got > tc.max {
+			t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", tc.value, got, tc.min, tc.max)
+		}
+	}
+}
+
+func TestNewHTTPErrorRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		want   time.Duration
+	}{
+		{http.StatusTooManyRequests, 7 * time.Second},
+		{http.StatusServiceUnavailable, 7 * time.Second},
+		// only 429 and 503 are asked to wait
+		{http.StatusInternalServerError, 0},
+	} {
+		resp := &http.Response{StatusCode: tc.status, Header: http.Header{"Retry-After": {"7"}}}
+		if got := newHTTPError(resp).RetryAfter; got != tc.want {
+			t.Errorf("%d: RetryAfter = %v, want %v", tc.status, got, tc.want)
+		}
+	}
+}
+
+func TestRetrierAttempts(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		maxRetries int
+		err        error
+		want       int
+	}{
+		{"default", 0, errors.New("down"), 6},
+		{"two retries", 2, errors.New("down"), 3},
+		{"disabled", -1, errors.New("down"), 1},
+		{"rejected", 5, &HTTPError{StatusCode: http.StatusBadRequest}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := RetryPolicy{MaxRetries: tc.maxRetries, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+			policy.setDefaults()
+			calls := 0
+			exp := exporterFunc(func(context.Context, []CreateLogRequest) error {
+				calls++
+				return tc.err
+			})
+			if err := (retrier{policy: policy}).export(context.Background(), exp, nil); !errors.Is(err, tc.err) {
+				t.Errorf("err = %v, want %v", err, tc.err)
+			}
+			if calls != tc.want {
+				t.Errorf("got %d attempts, want %d", calls, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetrierCapsRetryAfter(t *testing.T) {
+	calls := 0
+	exp := exporterFunc(func(context.Context, []CreateLogRequest) error {
+		calls++
+		if calls == 1 {
+			return &HTTPError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}
+		}
+		return nil
+	})
+	r := retrier{policy: RetryPolicy{MaxRetries: 1, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}}
+
+	start := time.Now()
+	if err := r.export(context.Background(), exp, nil); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("retry waited %v, want at most MaxBackoff", d)
+	}
+}
@@ -0,0 +1,178 @@
+package kulascope
+
+import (
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+
+	"github.com/kulawise/kulascope-go-sdk/redact"
+)
+
+// RoutePolicy sets what is captured for the requests it matches
+type RoutePolicy struct {
+	// Match is a glob over the request path, where * stays within one
+	// segment and ** spans segments, e.g. "/static/**", or a regular
+	// expression prefixed with "regexp:", e.g. "regexp:^/v[0-9]+/admin"
+	Match string
+	// HeadersOnly drops both bodies
+	HeadersOnly bool
+	// NoResponseBody drops the response body
+	NoResponseBody bool
+	// MaxBodyBytes replaces MaxRequestBodyBytes and MaxResponseBodyBytes
+	// for the matched requests; -1 captures bodies whole
+	MaxBodyBytes int
+	// RedactHeaders, RedactRequestBody and RedactResponseBody add rules for
+	// the matched requests on top of the Config lists
+	RedactHeaders      []string
+	RedactRequestBody  []string
+	RedactResponseBody []string
+}
+
+// routePolicy is a RoutePolicy with its pattern and rules compiled
+type routePolicy struct {
+	RoutePolicy
+	match         *regexp.Regexp
+	headerRules   redact.Redactor
+	requestRules  redact.Redactor
+	responseRules redact.Redactor
+}
+
+// compileRoutePattern turns a glob, or a "regexp:" expression, into a
+// regular expression
+func compileRoutePattern(pattern string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(pattern, "regexp:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("kulascope: invalid route pattern %q: %w", pattern, err)
+		}
+		return re, nil
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func compileRoutePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := compileRoutePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+// compileRoutePolicies compiles each policy's pattern and its redaction
+// rules merged with the config's
+func compileRoutePolicies(cfg Config) ([]routePolicy, error) {
+	policies := make([]routePolicy, 0, len(cfg.RoutePolicies))
+	for _, p := range cfg.RoutePolicies {
+		match, err := compileRoutePattern(p.Match)
+		if err != nil {
+			return nil, err
+		}
+		rp := routePolicy{RoutePolicy: p, match: match}
+		if rp.headerRules, err = compileRules(mergeRedactKeys(cfg.RedactHeaders, p.RedactHeaders), cfg); err != nil {
+			return nil, err
+		}
+		if rp.requestRules, err = compileRules(mergeRedactKeys(cfg.RedactRequestBody, p.RedactRequestBody), cfg); err != nil {
+			return nil, err
+		}
+		if rp.responseRules, err = compileRules(mergeRedactKeys(cfg.RedactResponseBody, p.RedactResponseBody), cfg); err != nil {
+			return nil, err
+		}
+		policies = append(policies, rp)
+	}
+	return policies, nil
+}
+
+func matchAny(patterns []*regexp.Regexp, path string) bool {
+	for _, re := range patterns {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// captures reports whether requests to path are captured at all, per
+// IncludeRoutes and ExcludeRoutes
+func (c *Client) captures(path string) bool {
+	if len(c.includeRoutes) > 0 && !matchAny(c.includeRoutes, path) {
+		return false
+	}
+	return !matchAny(c.excludeRoutes, path)
+}
+
+// policyFor returns the first route policy matching path, or nil
+func (c *Client) policyFor(path string) *routePolicy {
+	for i := range c.routePolicies {
+		if c.routePolicies[i].match.MatchString(path) {
+			return &c.routePolicies[i]
+		}
+	}
+	return nil
+}
+
+// bodyLimits returns how many bytes of each body are captured for a
+// request under policy; a negative limit captures the whole body
+func (c *Client) bodyLimits(policy *routePolicy) (request, response int) {
+	if policy != nil && policy.MaxBodyBytes != 0 {
+		return policy.MaxBodyBytes, policy.MaxBodyBytes
+	}
+	return c.cfg.MaxRequestBodyBytes, c.cfg.MaxResponseBodyBytes
+}
+
+// binaryContentType reports whether a body of this type is binary and
+// must never be captured
+func binaryContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	if top, _, _ := strings.Cut(mediaType, "/"); top == "image" || top == "audio" || top == "video" || top == "font" {
+		return true
+	}
+	switch mediaType {
+	case "application/octet-stream",
+		"application/protobuf",
+		"application/x-protobuf",
+		"application/vnd.google.protobuf",
+		"application/grpc",
+		"application/grpc+proto",
+		"application/pdf",
+		"application/zip",
+		"application/gzip",
+		"application/x-tar",
+		"application/wasm",
+		"application/msgpack",
+		"application/x-msgpack",
+		"application/cbor",
+		"application/avro":
+		return true
+	}
+	return false
+}
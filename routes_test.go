@@ -0,0 +1,133 @@
+package kulascope
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompileRoutePattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/healthz", "/healthz", true},
+		{"/healthz", "/healthz/live", false},
+		{"/static/*", "/static/app.js", true},
+		{"/static/*", "/static/js/app.js", false},
+		{"/static/**", "/static/js/app.js", true},
+		{"/users/*/keys", "/users/7/keys", true},
+		{"/users/*/keys", "/users/7/8/keys", false},
+		{"/v?/search", "/v2/search", true},
+		{"/v?/search", "/v10/search", false},
+		{"/a.b", "/axb", false},
+		{"/a+(b)", "/a+(b)", true},
+		{"regexp:^/v[0-9]+/admin", "/v12/admin/users", true},
+		{"regexp:^/v[0-9]+/admin", "/api/v1/admin", false},
+		{"regexp:report", "/monthly-report.csv", true},
+	} {
+		re, err := compileRoutePattern(tc.pattern)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.pattern, err)
+		}
+		if got := re.MatchString(tc.path); got != tc.want {
+			t.Errorf("%q on %q: matched = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+
+	if _, err := compileRoutePattern("regexp:(unclosed"); err == nil {
+		t.Error("invalid regexp accepted")
+	}
+	if _, err := New(Config{APIKey: "test", ExcludeRoutes: []string{"regexp:["}}); err == nil {
+		t.Error("New accepted an invalid exclude pattern")
+	}
+}
+
+func TestRouteFilters(t *testing.T) {
+	client, _ := newTestClient(t, Config{
+		IncludeRoutes: []string{"/api/**", "regexp:^/v[0-9]+/"},
+		ExcludeRoutes: []string{"/api/healthz", "/api/static/**"},
+	})
+	for path, want := range map[string]bool{
+		"/api/orders":        true,
+		"/v2/search":         true,
+		"/api/healthz":       false,
+		"/api/static/app.js": false,
+		"/metrics":           false,
+	} {
+		if got := client.captures(path); got != want {
+			t.Errorf("captures(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestRoutePolicyHeadersOnly(t *testing.T) {
+	client, flush := newTestClient(t, Config{RoutePolicies: []RoutePolicy{
+		{Match: "/files/*", HeadersOnly: true},
+		{Match: "/reports/**", NoResponseBody: true},
+	}})
+	handler := client.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "response body")
+	}))
+	for _, path := range []string{"/files/a.txt", "/reports/2024/q1", "/other"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("request body"))
+		req.Header.Set("Content-Type", "text/plain")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	got := make(map[string]map[string]any)
+	for _, r := range flush() {
+		got[*r.Path] = r.Metadata
+	}
+	for path, want := range map[string][2]any{
+		"/files/a.txt":     {"policy", "policy"},
+		"/reports/2024/q1": {nil, "policy"},
+		"/other":           {nil, nil},
+	} {
+		meta := got[path]
+		if meta == nil {
+			t.Fatalf("%s not captured", path)
+		}
+		if meta["request_body_skipped"] != want[0] || meta["response_body_skipped"] != want[1] {
+			t.Errorf("%s: skipped %v and %v, want %v and %v", path, meta["request_body_skipped"], meta["response_body_skipped"], want[0], want[1])
+		}
+		if meta["request_size"] != float64(len("request body")) {
+			t.Errorf("%s: request size %v", path, meta["request_size"])
+		}
+	}
+	if meta := got["/files/a.txt"]; meta["request_body"] != "" || meta["response_body"] != "" {
+		t.Errorf("HeadersOnly kept bodies %q and %q", meta["request_body"], meta["response_body"])
+	}
+	if meta := got["/files/a.txt"]; meta["request_headers"] == nil || meta["response_headers"] == nil {
+		t.Error("HeadersOnly dropped the headers")
+	}
+}
+
+func TestBinaryContentType(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"":                                      false,
+		"application/json":                      false,
+		"text/html; charset=utf-8":              false,
+		"application/x-www-form-urlencoded":     false,
+		"image/png":                             true,
+		"IMAGE/JPEG":                            true,
+		"video/mp4":                             true,
+		"font/woff2":                            true,
+		"application/protobuf":                  true,
+		"application/x-protobuf; messageType=x": true,
+		"application/grpc+proto":                true,
+		"application/octet-stream":              true,
+		"application/octet-stream; name=a.bin":  true,
+		"Application/Octet-Stream ; q=1":        true,
+		"application/octet-stream; bad==":       true,
+		"application/pdf":                       true,
+	} {
+		if got := binaryContentType(contentType); got != want {
+			t.Errorf("binaryContentType(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package kulascope
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kulawise/kulascope-go-sdk/log"
+)
+
+// Sampling keeps a share of requests instead of capturing every one. The
+// head decision hashes the trace ID, so every service in a propagated
+// trace keeps or drops it together. Tail rules, checked once the request
+// has finished, keep it anyway if it failed with a 5xx or an error, logged
+// an error-level sub-log or was slow.
+type Sampling struct {
+	// Rate is the share of requests kept, from 0 to 1
+	Rate float64
+	// RouteRates overrides Rate by route template, e.g.
+	// {"/healthz": 0, "/orders/:id": 0.5}. gRPC calls use the full method.
+	RouteRates map[string]float64
+	// SlowThreshold keeps requests that took at least this long; zero
+	// turns the rule off
+	SlowThreshold time.Duration
+}
+
+func (s *Sampling) validate() error {
+	if s.Rate < 0 || s.Rate > 1 {
+		return fmt.Errorf("kulascope: sampling rate %v is outside 0..1", s.Rate)
+	}
+	for route, rate := range s.RouteRates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("kulascope: sampling rate %v for %q is outside 0..1", rate, route)
+		}
+	}
+	return nil
+}
+
+// sampledIn reports whether the head rate for route keeps the trace. It
+// compares the trace ID's low 56 bits, the part W3C trace IDs keep random,
+// against the rate.
+func (s *Sampling) sampledIn(route string, traceID uuid.UUID) bool {
+	rate, ok := s.RouteRates[route]
+	if !ok {
+		rate = s.Rate
+	}
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	}
+	const bits = 56
+	n := binary.BigEndian.Uint64(traceID[8:]) & (1<<bits - 1)
+	return n < uint64(rate*(1<<bits))
+}
+
+// finishedRequest is what the tail rules look at
+type finishedRequest struct {
+	route   string
+	traceID uuid.UUID
+	failed  bool // 5xx, or an error returned by a gRPC handler
+	latency time.Duration
+	subLogs []log.SubLogRequest
+}
+
+// keep decides whether a finished request is captured. Requests dropped
+// here are still counted in the route metrics.
+func (c *Client) keep(r finishedRequest) bool {
+	s := c.cfg.Sampling
+	if s == nil || s.sampledIn(r.route, r.traceID) || r.failed {
+		return true
+	}
+	if s.SlowThreshold > 0 && r.latency >= s.SlowThreshold {
+		return true
+	}
+	for _, l := range r.subLogs {
+		switch l.Level {
+		case "error", "fatal", "panic":
+			return true
+		}
+	}
+	c.sampledOut.Add(1)
+	return false
+}
@@ -0,0 +1,104 @@
+package kulascope
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kulawise/kulascope-go-sdk/log"
+)
+
+func TestSamplingHeadRates(t *testing.T) {
+	s := &Sampling{Rate: 0.25, RouteRates: map[string]float64{"/healthz": 0, "/orders/:id": 1, "/users": 0.5}}
+	for _, tc := range []struct {
+		route string
+		want  float64
+	}{
+		{"/other", 0.25},
+		{"/healthz", 0},
+		{"/orders/:id", 1},
+		{"/users", 0.5},
+	} {
+		const n = 20_000
+		kept := 0
+		for range n {
+			traceID := uuid.New()
+			in := s.sampledIn(tc.route, traceID)
+			if in != s.sampledIn(tc.route, traceID) {
+				t.Fatalf("%s: decision for %s changed between calls", tc.route, traceID)
+			}
+			if in {
+				kept++
+			}
+		}
+		if got := float64(kept) / n; got < tc.want-0.02 || got > tc.want+0.02 {
+			t.Errorf("%s: kept %.3f of traces, want %.2f", tc.route, got, tc.want)
+		}
+	}
+}
+
+func TestSamplingStablePerTrace(t *testing.T) {
+	// the decision depends on the trace ID's low bits only, so a rate that
+	// keeps a trace keeps it at every higher rate too
+	low := uuid.MustParse("4bf92f35-77b3-4da6-0000-000000000001")
+	high := uuid.MustParse("4bf92f35-77b3-4da6-00ff-ffffffffffff")
+	for _, tc := range []struct {
+		rate      float64
+		low, high bool
+	}{
+		{0, false, false},
+		{0.01, true, false},
+		{0.99, true, false},
+		{1, true, true},
+	} {
+		s := &Sampling{Rate: tc.rate}
+		if got := s.sampledIn("/", low); got != tc.low {
+			t.Errorf("rate %v: low trace kept = %v, want %v", tc.rate, got, tc.low)
+		}
+		if got := s.sampledIn("/", high); got != tc.high {
+			t.Errorf("rate %v: high trace kept = %v, want %v", tc.rate, got, tc.high)
+		}
+	}
+}
+
+func TestSamplingTailRules(t *testing.T) {
+	dropped := uuid.MustParse("4bf92f35-77b3-4da6-00ff-ffffffffffff")
+	for _, tc := range []struct {
+		name string
+		req  finishedRequest
+		want bool
+	}{
+		{"sampled out", finishedRequest{}, false},
+		{"failed", finishedRequest{failed: true}, true},
+		{"slow", finishedRequest{latency: time.Second}, true},
+		{"just under the threshold", finishedRequest{latency: 999 * time.Millisecond}, false},
+		{"error sub-log", finishedRequest{subLogs: []log.SubLogRequest{{Level: "info"}, {Level: "error"}}}, true},
+		{"warn sub-log", finishedRequest{subLogs: []log.SubLogRequest{{Level: "warn"}}}, false},
+	} {
+		c := &Client{cfg: Config{Sampling: &Sampling{Rate: 0.5, SlowThreshold: time.Second}}}
+		tc.req.traceID = dropped
+		if got := c.keep(tc.req); got != tc.want {
+			t.Errorf("%s: keep = %v, want %v", tc.name, got, tc.want)
+		}
+		if sampledOut := c.sampledOut.Load() == 1; sampledOut == tc.want {
+			t.Errorf("%s: sampled-out count = %d", tc.name, c.sampledOut.Load())
+		}
+	}
+}
+
+func TestSamplingValidate(t *testing.T) {
+	for _, tc := range []struct {
+		s  Sampling
+		ok bool
+	}{
+		{Sampling{Rate: 0}, true},
+		{Sampling{Rate: 1, RouteRates: map[string]float64{"/a": 0.1}}, true},
+		{Sampling{Rate: 1.5}, false},
+		{Sampling{Rate: -0.1}, false},
+		{Sampling{Rate: 0.5, RouteRates: map[string]float64{"/a": 2}}, false},
+	} {
+		if err := tc.s.validate(); (err == nil) != tc.ok {
+			t.Errorf("validate(%+v) = %v", tc.s, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package kulascope
+
+import (
+	"context"
+	"time"
+)
+
+// Flush sends everything queued so far and waits for it to be delivered.
+// The client keeps accepting logs while flushing. It returns how many
+// records could not be delivered, either because they failed or because
+// ctx expired before they were sent. If the exporter rejected a batch,
+// e.g. with a 400 or 401, the error wraps the latest rejection.
+func (c *Client) Flush(ctx context.Context) (int, error) {
+	failedBefore := c.failed.Load()
+	rejectedBefore := c.rejected.Load()
+
+	err := c.waitIdle(ctx)
+	if err == nil {
+		err = c.rejectionSince(rejectedBefore)
+	}
+
+	undelivered := int(c.failed.Load() - failedBefore)
+	if err != nil {
+		undelivered += int(c.pending.Load())
+	}
+	return undelivered, err
+}
+
+// Shutdown stops accepting new logs, drains the log and send queues and
+// waits for in-flight sends, then shuts the exporter down. If ctx expires
+// first, in-flight sends and retries are aborted. It returns how many records could not be delivered;
+// with a spool configured those records are replayed on the next start.
+func (c *Client) Shutdown(ctx context.Context) (int, error) {
+	if !c.accepting.CompareAndSwap(true, false) {
+		return 0, nil
+	}
+	// wake enqueues blocked on a full queue, then wait for those that saw
+	// accepting set, so nothing is queued once the workers start draining
+	close(c.stopping)
+	c.acceptMu.Lock()
+	c.acceptMu.Unlock()
+	failedBefore := c.failed.Load()
+	rejectedBefore := c.rejected.Load()
+
+	close(c.stopLog)
+	if c.overflow != nil {
+		// stop refilling the queue before the workers drain it
+		close(c.stopOverflow)
+		<-c.overflowDone
+	}
+	close(c.stopSenders)
+
+	done := make(chan struct{})
+	go func() {
+		c.senderWG.Wait()
+		if c.fanout != nil {
+			c.fanout.drain()
+		}
+		<-c.logDone
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		// abort in-flight sends and backoff so the workers exit promptly
+		c.cancel()
+		<-done
+	}
+	c.cancel()
+	if err == nil {
+		err = c.rejectionSince(rejectedBefore)
+	}
+
+	if exportErr := c.exporter.Shutdown(ctx); exportErr != nil && err == nil {
+		err = exportErr
+	}
+
+	if c.spool != nil {
+		c.spool.close()
+	}
+	if c.overflow != nil {
+		c.overflow.close()
+	}
+
+	undelivered := int(c.failed.Load()-failedBefore) + int(c.pending.Load())
+	return undelivered, err
+}
+
+// waitIdle blocks until both queues are drained and no send is in flight.
+// Workers are nudged to send partial batches instead of waiting for
+// BatchInterval.
+func (c *Client) waitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if c.pending.Load() == 0 && c.logPending.Load() == 0 {
+			return nil
+		}
+		for _, sig := range c.flushSignals {
+			select {
+			case sig <- struct{}{}:
+			default:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush flushes every client created through Init or Middleware
+func Flush(ctx context.Context) (int, error) {
+	var total int
+	var firstErr error
+	for _, c := range listManaged() {
+		n, err := c.Flush(ctx)
+		total += n
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return total, firstErr
+}
+
+// Shutdown shuts down every client created through Init or Middleware
+func Shutdown(ctx context.Context) (int, error) {
+	var total int
+	var firstErr error
+	for _, c := range takeManaged() {
+		n, err := c.Shutdown(ctx)
+		total += n
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return total, firstErr
+}
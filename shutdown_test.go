@@ -0,0 +1,126 @@
+package kulascope
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestFlushCountsUndelivered(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	client, err := New(Config{
+		APIKey:         "test",
+		DisableBreaker: true,
+		Exporter: exporterFunc(func(context.Context, []CreateLogRequest) error {
+			if down.Load() {
+				return Permanent(errors.New("unauthorized"))
+			}
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown(context.Background())
+
+	for range 3 {
+		client.enqueue(CreateLogRequest{Level: "info", Message: "m", Timestamp: time.Now()})
+	}
+	if n, err := client.Flush(context.Background()); n != 3 || err == nil {
+		t.Fatalf("Flush = %d, %v; want 3 undelivered and an error", n, err)
+	}
+
+	// only records given up on since the previous Flush count
+	down.Store(false)
+	client.enqueue(CreateLogRequest{Level: "info", Message: "m", Timestamp: time.Now()})
+	if n, err := client.Flush(context.Background()); n != 0 || err != nil {
+		t.Fatalf("Flush = %d, %v; want 0 and no error", n, err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	client, err := New(Config{
+		APIKey: "test",
+		Exporter: exporterFunc(func(ctx context.Context, _ []CreateLogRequest) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		client.enqueue(CreateLogRequest{Level: "info", Message: "m", Timestamp: time.Now()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	n, err := client.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || n != 2 {
+		t.Fatalf("Shutdown = %d, %v; want 2 undelivered and the deadline", n, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Shutdown took %v past its deadline", elapsed)
+	}
+}
+
+func TestEnqueueDuringShutdown(t *testing.T) {
+	client, err := New(Config{
+		APIKey:        "test",
+		QueueSize:     4,
+		QueueOverflow: OverflowBlock,
+		Exporter: exporterFunc(func(context.Context, []CreateLogRequest) error {
+			time.Sleep(time.Millisecond)
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg              sync.WaitGroup
+		logged, written atomic.Int64
+		enqueued        atomic.Int64
+	)
+	stop := make(chan struct{})
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				logged.Add(1)
+				client.AsyncLog(func(zerolog.Logger) { written.Add(1) })
+				enqueued.Add(1)
+				client.enqueue(CreateLogRequest{Level: "info", Message: "m", Timestamp: time.Now()})
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := client.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(stop)
+	wg.Wait()
+
+	if logged.Load() != written.Load() {
+		t.Errorf("%d AsyncLog calls, %d written", logged.Load(), written.Load())
+	}
+	s := client.Stats()
+	if s.Pending != 0 || s.Delivered+s.Failed != enqueued.Load() {
+		t.Errorf("%d enqueued, %d delivered, %d failed, %d pending", enqueued.Load(), s.Delivered, s.Failed, s.Pending)
+	}
+}
@@ -0,0 +1,478 @@
+package kulascope
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy controls when spool segments are fsynced to disk
+type SyncPolicy string
+
+const (
+	// SyncAlways fsyncs after every record
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsyncs the active segment every SpoolSyncInterval
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system
+	SyncNever SyncPolicy = "never"
+)
+
+const (
+	segmentExt = ".seg"
+	// an ack file lists, as little-endian uint32s, the frames of its
+	// segment that were delivered or given up on
+	ackExt = ".ack"
+	// frame header: 4 byte length + 4 byte crc32 of the payload
+	frameHeaderSize = 8
+	maxFrameSize    = 64 << 20
+)
+
+var errCorruptFrame = errors.New("corrupt spool frame")
+
+// segment is a single append-only spool file. Once sealed, it is deleted
+// as soon as every record in it has been acknowledged by the ingest API.
+// Acknowledged frames are recorded next to it, so a restart only replays
+// the rest.
+type segment struct {
+	id      uint64
+	path    string
+	file    *os.File // nil once sealed
+	size    int64
+	records int
+	acked   map[int]bool // by frame index
+	evicted bool
+	// draining marks a segment being read back by the overflow drainer,
+	// which keeps it from being evicted
+	draining bool
+}
+
+// spool is a file-backed write-ahead log sitting in front of sendQueue.
+// Every record is written before it is queued, so anything that has not
+// been acknowledged when the process stops is replayed on the next start.
+type spool struct {
+	dir          string
+	segmentBytes int64
+	maxBytes     int64
+	syncPolicy   SyncPolicy
+	// onEvict, when set, is told how many unacknowledged records each
+	// evicted segment held
+	onEvict func(records int)
+
+	mu       sync.Mutex
+	segments []*segment // oldest first, the last one is active while open
+	total    int64
+	nextID   uint64
+	closed   bool
+
+	stop chan struct{}
+}
+
+// replayBatch holds the records recovered from one segment on startup,
+// with the frame index of each
+type replayBatch struct {
+	seg    *segment
+	bodies [][]byte
+	frames []int
+}
+
+// openSpool opens (or creates) the spool directory and returns every record
+// that was written but never acknowledged by a previous process
+func openSpool(cfg Config) (*spool, []replayBatch, error) {
+	if err := os.MkdirAll(cfg.SpoolDir, 0o755); err != nil {
+		return nil, nil, fmt.Errorf("create spool dir: %w", err)
+	}
+
+	s := &spool{
+		dir:          cfg.SpoolDir,
+		segmentBytes: cfg.SpoolSegmentBytes,
+		maxBytes:     cfg.SpoolMaxBytes,
+		syncPolicy:   cfg.SpoolSync,
+		stop:         make(chan struct{}),
+	}
+
+	ids, err := s.listSegments()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var replay []replayBatch
+	for _, id := range ids {
+		seg := &segment{id: id, path: s.segmentPath(id)}
+		bodies, size, err := readSegment(seg.path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if id >= s.nextID {
+			s.nextID = id + 1
+		}
+		seg.acked = readAcks(ackPath(seg.path), len(bodies))
+		if len(seg.acked) >= len(bodies) {
+			os.Remove(seg.path)
+			os.Remove(ackPath(seg.path))
+			continue
+		}
+		seg.size = size
+		seg.records = len(bodies)
+		s.segments = append(s.segments, seg)
+		s.total += size
+
+		rb := replayBatch{seg: seg}
+		for i, body := range bodies {
+			if !seg.acked[i] {
+				rb.bodies = append(rb.bodies, body)
+				rb.frames = append(rb.frames, i)
+			}
+		}
+		replay = append(replay, rb)
+	}
+
+	if s.syncPolicy == SyncInterval {
+		go s.syncLoop(cfg.SpoolSyncInterval)
+	}
+
+	return s, replay, nil
+}
+
+func (s *spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+func ackPath(segmentPath string) string {
+	return strings.TrimSuffix(segmentPath, segmentExt) + ackExt
+}
+
+// listSegments returns the IDs of the segments on disk, oldest first, and
+// removes ack files left behind by segments that are gone
+func (s *spool) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spool dir: %w", err)
+	}
+	var ids []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasSuffix(name, ackExt) {
+			seg := strings.TrimSuffix(name, ackExt) + segmentExt
+			if _, err := os.Stat(filepath.Join(s.dir, seg)); errors.Is(err, os.ErrNotExist) {
+				os.Remove(filepath.Join(s.dir, name))
+			}
+			continue
+		}
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// readSegment returns every intact record in the file. A torn or corrupt
+// tail, e.g. from a crash mid-write, ends the segment instead of failing it.
+func readSegment(path string) ([][]byte, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("open spool segment: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var bodies [][]byte
+	var size int64
+	for {
+		body, err := readFrame(r)
+		if err != nil {
+			break
+		}
+		bodies = append(bodies, body)
+		size += int64(frameHeaderSize + len(body))
+	}
+	return bodies, size, nil
+}
+
+// readAcks returns the frames recorded in an ack file. A torn last entry
+// is ignored, so its frame is replayed.
+func readAcks(path string, records int) map[int]bool {
+	acked := make(map[int]bool)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return acked
+	}
+	for len(data) >= 4 {
+		if i := int(binary.LittleEndian.Uint32(data)); i < records {
+			acked[i] = true
+		}
+		data = data[4:]
+	}
+	return acked
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var hdr [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(hdr[0:4])
+	sum := binary.LittleEndian.Uint32(hdr[4:8])
+	if n == 0 || n > maxFrameSize {
+		return nil, errCorruptFrame
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, errCorruptFrame
+	}
+	return body, nil
+}
+
+// append writes one record to the active segment, rotating and evicting
+// old segments as needed, and returns the segment that now holds it and
+// the record's frame index within it
+func (s *spool) append(body []byte) (*segment, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, 0, errors.New("spool is closed")
+	}
+
+	frameLen := int64(frameHeaderSize + len(body))
+
+	active := s.active()
+	if active == nil || (active.records > 0 && active.size+frameLen > s.segmentBytes) {
+		var err error
+		if active, err = s.rotate(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	frame := make([]byte, frameHeaderSize+len(body))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(body)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(body))
+	copy(frame[frameHeaderSize:], body)
+
+	if _, err := active.file.Write(frame); err != nil {
+		return nil, 0, fmt.Errorf("write spool segment: %w", err)
+	}
+	if s.syncPolicy == SyncAlways {
+		if err := active.file.Sync(); err != nil {
+			return nil, 0, fmt.Errorf("sync spool segment: %w", err)
+		}
+	}
+
+	frameIndex := active.records
+	active.size += frameLen
+	active.records++
+	s.total += frameLen
+
+	s.evict()
+	return active, frameIndex, nil
+}
+
+// active returns the segment currently open for writing, if any
+func (s *spool) active() *segment {
+	if len(s.segments) == 0 {
+		return nil
+	}
+	if last := s.segments[len(s.segments)-1]; last.file != nil {
+		return last
+	}
+	return nil
+}
+
+// rotate seals the active segment and opens a fresh one
+func (s *spool) rotate() (*segment, error) {
+	if active := s.active(); active != nil {
+		s.seal(active)
+	}
+
+	seg := &segment{id: s.nextID, path: s.segmentPath(s.nextID), acked: make(map[int]bool)}
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("create spool segment: %w", err)
+	}
+	seg.file = f
+	s.nextID++
+	s.segments = append(s.segments, seg)
+	return seg, nil
+}
+
+func (s *spool) seal(seg *segment) {
+	if seg.file == nil {
+		return
+	}
+	if s.syncPolicy != SyncNever {
+		seg.file.Sync()
+	}
+	seg.file.Close()
+	seg.file = nil
+	if len(seg.acked) >= seg.records {
+		s.remove(seg)
+	}
+}
+
+// evict drops the oldest segments until the spool fits its disk budget.
+// The active segment is never evicted.
+func (s *spool) evict() {
+	for s.total > s.maxBytes && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		if oldest.file != nil || oldest.draining {
+			return
+		}
+		oldest.evicted = true
+		s.remove(oldest)
+		if s.onEvict != nil {
+			s.onEvict(oldest.records - len(oldest.acked))
+		}
+	}
+}
+
+func (s *spool) remove(seg *segment) {
+	for i, other := range s.segments {
+		if other == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			s.total -= seg.size
+			os.Remove(seg.path)
+			os.Remove(ackPath(seg.path))
+			return
+		}
+	}
+}
+
+// ack marks frames of seg as delivered, or given up on. They are recorded
+// in the segment's ack file unless that finishes the segment.
+func (s *spool) ack(seg *segment, frames ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seg.evicted {
+		return
+	}
+	var fresh []int
+	for _, i := range frames {
+		if !seg.acked[i] {
+			seg.acked[i] = true
+			fresh = append(fresh, i)
+		}
+	}
+	if len(seg.acked) >= seg.records && seg.file == nil {
+		s.remove(seg)
+		return
+	}
+	if len(fresh) > 0 {
+		s.writeAcks(seg, fresh)
+	}
+}
+
+// ackAll marks every record of seg as delivered
+func (s *spool) ackAll(seg *segment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seg.evicted {
+		return
+	}
+	for i := range seg.records {
+		seg.acked[i] = true
+	}
+	if seg.file == nil {
+		s.remove(seg)
+	}
+}
+
+// writeAcks appends frames to seg's ack file. Acks that fail to reach the
+// disk only mean the records are sent again after a restart.
+func (s *spool) writeAcks(seg *segment, frames []int) {
+	buf := make([]byte, 4*len(frames))
+	for j, i := range frames {
+		binary.LittleEndian.PutUint32(buf[4*j:], uint32(i))
+	}
+	f, err := os.OpenFile(ackPath(seg.path), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(buf); err == nil && s.syncPolicy == SyncAlways {
+		f.Sync()
+	}
+}
+
+// takeOldest seals the oldest segment and returns it with its records.
+// It stays on disk, safe from eviction, until they are acknowledged.
+func (s *spool) takeOldest() (*segment, [][]byte, error) {
+	s.mu.Lock()
+	if len(s.segments) == 0 || s.segments[0].records == 0 || s.segments[0].draining {
+		s.mu.Unlock()
+		return nil, nil, nil
+	}
+	seg := s.segments[0]
+	s.seal(seg)
+	seg.draining = true
+	s.mu.Unlock()
+
+	bodies, _, err := readSegment(seg.path)
+	if err != nil {
+		s.mu.Lock()
+		seg.draining = false
+		s.mu.Unlock()
+		return nil, nil, err
+	}
+	return seg, bodies, nil
+}
+
+// bytes returns the size of every segment on disk
+func (s *spool) bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+func (s *spool) syncLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if active := s.active(); active != nil {
+				active.file.Sync()
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// close seals the active segment. Unacknowledged records stay on disk.
+func (s *spool) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	if active := s.active(); active != nil {
+		s.seal(active)
+	}
+}
@@ -0,0 +1,317 @@
+package kulascope
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSpoolReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		APIKey:         "test",
+		Compression:    CompressionNone,
+		SpoolDir:       dir,
+		DisableBreaker: true,
+	}
+
+	down := cfg
+	down.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+	})
+	first, err := New(down)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.enqueue(CreateLogRequest{Level: "info", Message: "kept", Timestamp: time.Now()})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := first.Shutdown(ctx); err == nil {
+		t.Fatal("Shutdown succeeded against a failing exporter")
+	}
+	if segments(t, dir) == 0 {
+		t.Fatal("no spool segment left after a failed Shutdown")
+	}
+
+	var got atomic.Int64
+	up := cfg
+	up.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		var records []CreateLogRequest
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &records); err == nil {
+			got.Add(int64(len(records)))
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	second, err := New(up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := second.Flush(context.Background()); n != 0 || err != nil {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	if got.Load() != 1 || second.Stats().Delivered != 1 {
+		t.Fatalf("replayed %d records, delivered %d; want 1", got.Load(), second.Stats().Delivered)
+	}
+	if _, err := second.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := segments(t, dir); n != 0 {
+		t.Fatalf("%d segments left after the replay was delivered", n)
+	}
+}
+
+func TestSpoolSkipsAckedRecordsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	// delivers "a" and fails everything else until the restart
+	restarted := false
+	cfg := Config{
+		APIKey:         "test",
+		Compression:    CompressionNone,
+		SpoolDir:       dir,
+		DisableBreaker: true,
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			var records []CreateLogRequest
+			json.NewDecoder(r.Body).Decode(&records)
+			mu.Lock()
+			defer mu.Unlock()
+			if !restarted && (len(records) != 1 || records[0].Message != "a") {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}
+			for _, rec := range records {
+				received = append(received, rec.Message)
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+	}
+
+	first, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.enqueue(CreateLogRequest{Message: "a", Timestamp: time.Now()})
+	if n, err := first.Flush(context.Background()); n != 0 || err != nil {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	first.enqueue(CreateLogRequest{Message: "b", Timestamp: time.Now()})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	first.Shutdown(ctx)
+
+	mu.Lock()
+	restarted = true
+	mu.Unlock()
+	second, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := second.Flush(context.Background()); n != 0 || err != nil {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	second.Shutdown(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(received, []string{"a", "b"}) {
+		t.Fatalf("exporter received %v, want [a b]", received)
+	}
+	if n := segments(t, dir); n != 0 {
+		t.Fatalf("%d segments left after everything was delivered", n)
+	}
+}
+
+func TestSpoolAckFile(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{SpoolDir: dir, SpoolSegmentBytes: 1 << 20, SpoolMaxBytes: 1 << 20, SpoolSync: SyncNever}
+	s, _, err := openSpool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seg *segment
+	for _, body := range []string{`{"n":0}`, `{"n":1}`, `{"n":2}`} {
+		if seg, _, err = s.append([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.ack(seg, 2, 0)
+	s.close()
+
+	s, replay, err := openSpool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replay) != 1 || len(replay[0].bodies) != 1 || string(replay[0].bodies[0]) != `{"n":1}` || replay[0].frames[0] != 1 {
+		t.Fatalf("replay = %+v, want only frame 1", replay)
+	}
+	s.ack(replay[0].seg, 1)
+	s.close()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("%d files left after every frame was acknowledged", len(entries))
+	}
+}
+
+func TestReadSegmentTornTail(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		tear func(data []byte) []byte
+		want int
+	}{
+		{"intact", func(b []byte) []byte { return b }, 3},
+		{"cut mid-frame", func(b []byte) []byte { return b[:len(b)-3] }, 2},
+		{"cut mid-header", func(b []byte) []byte { return b[:len(b)-len(`{"n":3}`)-frameHeaderSize+4] }, 2},
+		{"corrupt checksum", func(b []byte) []byte {
+			b[len(b)-len(`{"n":3}`)-1] ^= 0xff
+			return b
+		}, 2},
+		{"garbage tail", func(b []byte) []byte { return append(b, 0xde, 0xad, 0xbe, 0xef) }, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, replay, err := openSpool(Config{SpoolDir: dir, SpoolSegmentBytes: 1 << 20, SpoolMaxBytes: 1 << 20, SpoolSync: SyncNever})
+			if err != nil || len(replay) != 0 {
+				t.Fatalf("openSpool = %v, %d batches", err, len(replay))
+			}
+			var seg *segment
+			for _, body := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+				if seg, _, err = s.append([]byte(body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.close()
+
+			data, err := os.ReadFile(seg.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(seg.path, tc.tear(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			bodies, _, err := readSegment(seg.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bodies) != tc.want {
+				t.Fatalf("read %d records, want %d", len(bodies), tc.want)
+			}
+			for i, b := range bodies {
+				if want := `{"n":` + string(rune('1'+i)) + `}`; string(b) != want {
+					t.Errorf("record %d = %s, want %s", i, b, want)
+				}
+			}
+		})
+	}
+}
+
+func segments(t *testing.T, dir string) int {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(matches)
+}
+
+type exporterFunc func(context.Context, []CreateLogRequest) error
+
+func (f exporterFunc) Export(ctx context.Context, records []CreateLogRequest) error {
+	return f(ctx, records)
+}
+
+func (f exporterFunc) Shutdown(context.Context) error { return nil }
+
+func TestFanoutFailureKeepsSpool(t *testing.T) {
+	dir := t.TempDir()
+	var accepted atomic.Int64
+	client, err := New(Config{
+		APIKey:   "test",
+		SpoolDir: dir,
+		Exporter: NewFanoutExporter(
+			exporterFunc(func(_ context.Context, records []CreateLogRequest) error {
+				accepted.Add(int64(len(records)))
+				return nil
+			}),
+			exporterFunc(func(context.Context, []CreateLogRequest) error {
+				return Permanent(errors.New("sink down"))
+			}),
+		),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.enqueue(CreateLogRequest{Level: "info", Message: "kept", Timestamp: time.Now()})
+
+	n, err := client.Flush(context.Background())
+	if n != 1 || err == nil {
+		t.Fatalf("Flush = %d, %v; want 1 undelivered and an error", n, err)
+	}
+	if d := client.Stats().Delivered; d != 0 || accepted.Load() != 1 {
+		t.Fatalf("delivered %d, healthy sink got %d; want 0 and 1", d, accepted.Load())
+	}
+	client.Shutdown(context.Background())
+	if segments(t, dir) == 0 {
+		t.Fatal("spool segment acknowledged although a sink failed")
+	}
+}
+
+func TestFanoutSlowSinkDoesNotStallOthers(t *testing.T) {
+	release := make(chan struct{})
+	var accepted atomic.Int64
+	client, err := New(Config{
+		APIKey:        "test",
+		WorkerCount:   1,
+		BatchInterval: 10 * time.Millisecond,
+		Exporter: NewFanoutExporter(
+			exporterFunc(func(ctx context.Context, _ []CreateLogRequest) error {
+				select {
+				case <-release:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}),
+			exporterFunc(func(_ context.Context, records []CreateLogRequest) error {
+				accepted.Add(int64(len(records)))
+				return nil
+			}),
+		),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown(context.Background())
+
+	for i := range 3 {
+		client.enqueue(CreateLogRequest{Level: "info", Message: "m", Timestamp: time.Now()})
+		deadline := time.Now().Add(time.Second)
+		for accepted.Load() <= int64(i) {
+			if time.Now().After(deadline) {
+				t.Fatalf("healthy sink got %d of %d records while the other sink was blocked", accepted.Load(), i+1)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	if d := client.Stats().Delivered; d != 0 {
+		t.Fatalf("delivered %d before the blocked sink accepted", d)
+	}
+
+	close(release)
+	if n, err := client.Flush(context.Background()); n != 0 || err != nil {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	if d := client.Stats().Delivered; d != 3 {
+		t.Fatalf("delivered %d, want 3", d)
+	}
+}
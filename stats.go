@@ -0,0 +1,221 @@
+package kulascope
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ClientStats is a snapshot of a client's own health. Totals count from
+// the moment the client was created.
+type ClientStats struct {
+	// QueueLength and QueueCapacity describe the send queue
+	QueueLength   int `json:"queue_length"`
+	QueueCapacity int `json:"queue_capacity"`
+	// LogQueueLength and LogQueueCapacity describe the AsyncLog queue
+	LogQueueLength   int `json:"log_queue_length"`
+	LogQueueCapacity int `json:"log_queue_capacity"`
+	// Pending is how many records are queued, spilled or in flight
+	Pending int64 `json:"pending"`
+
+	Delivered int64 `json:"delivered"`
+	// Failed counts every record given up on, including Dropped
+	Failed int64 `json:"failed"`
+	// Dropped counts records dropped by the overflow policy or evicted
+	// from the overflow spool
+	Dropped      int64 `json:"dropped"`
+	Spilled      int64 `json:"spilled"`
+	DeadLettered int64 `json:"dead_lettered"`
+	// SampledOut counts requests not captured because of Sampling
+	SampledOut int64 `json:"sampled_out"`
+	// LogDropped counts AsyncLog calls dropped because its queue was full
+	LogDropped int64 `json:"log_dropped"`
+
+	BatchesSent     int64 `json:"batches_sent"`
+	BatchesRejected int64 `json:"batches_rejected"`
+	// BytesSent is the uncompressed size of the delivered batches
+	BytesSent int64 `json:"bytes_sent"`
+	// ExportAttempts counts calls to the exporter, of which ExportRetries
+	// were retries and ExportErrors failed
+	ExportAttempts int64 `json:"export_attempts"`
+	ExportRetries  int64 `json:"export_retries"`
+	ExportErrors   int64 `json:"export_errors"`
+	// ExportTime is the total time spent in the exporter
+	ExportTime time.Duration `json:"export_time_ns"`
+
+	// Breaker is "closed", "open" or "half-open", or empty when disabled
+	Breaker       string `json:"breaker,omitempty"`
+	SpoolBytes    int64  `json:"spool_bytes"`
+	OverflowBytes int64  `json:"overflow_bytes"`
+}
+
+// Stats returns a snapshot of the client's queues and counters
+func (c *Client) Stats() ClientStats {
+	s := ClientStats{
+		QueueLength:      len(c.sendQueue),
+		QueueCapacity:    cap(c.sendQueue),
+		LogQueueLength:   len(c.logChan),
+		LogQueueCapacity: cap(c.logChan),
+		Pending:          c.pending.Load(),
+		Delivered:        c.delivered.Load(),
+		Failed:           c.failed.Load(),
+		Dropped:          c.dropped.Load(),
+		Spilled:          c.spilled.Load(),
+		DeadLettered:     c.deadLettered.Load(),
+		SampledOut:       c.sampledOut.Load(),
+		LogDropped:       c.logDropped.Load(),
+		BatchesSent:      c.batches.Load(),
+		BatchesRejected:  c.rejected.Load(),
+		BytesSent:        c.bytesSent.Load(),
+		ExportAttempts:   c.exports.attempts.Load(),
+		ExportRetries:    c.exports.retries.Load(),
+		ExportErrors:     c.exports.errors.Load(),
+		ExportTime:       time.Duration(c.exports.nanos.Load()),
+	}
+	if c.breaker != nil {
+		s.Breaker = c.breaker.current().String()
+	}
+	if c.spool != nil {
+		s.SpoolBytes = c.spool.bytes()
+	}
+	if c.overflow != nil {
+		s.OverflowBytes = c.overflow.bytes()
+	}
+	return s
+}
+
+// Stats returns a snapshot of the default client, or zero values before
+// Init
+func Stats() ClientStats {
+	if c := getDefault(); c != nil {
+		return c.Stats()
+	}
+	return ClientStats{}
+}
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// MetricsHandler serves the client's stats and route metrics in the
+// Prometheus text format
+func (c *Client) MetricsHandler() http.Handler {
+	return metricsHandler(func() *Client { return c })
+}
+
+// FiberMetricsHandler is MetricsHandler for Fiber
+func (c *Client) FiberMetricsHandler() fiber.Handler {
+	return fiberMetricsHandler(func() *Client { return c })
+}
+
+// MetricsHandler serves the default client's stats and route metrics in
+// the Prometheus text format
+func MetricsHandler() http.Handler {
+	return metricsHandler(getDefault)
+}
+
+// FiberMetricsHandler is MetricsHandler for Fiber
+func FiberMetricsHandler() fiber.Handler {
+	return fiberMetricsHandler(getDefault)
+}
+
+func metricsHandler(client func() *Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metricsContentType)
+		if c := client(); c != nil {
+			c.writeMetrics(w)
+		}
+	})
+}
+
+func fiberMetricsHandler(client func() *Client) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		ctx.Set(fiber.HeaderContentType, metricsContentType)
+		var buf bytes.Buffer
+		if c := client(); c != nil {
+			c.writeMetrics(&buf)
+		}
+		return ctx.Send(buf.Bytes())
+	}
+}
+
+// writeMetrics writes the client's stats and route metrics in the
+// Prometheus text format
+func (c *Client) writeMetrics(w io.Writer) {
+	s := c.Stats()
+
+	var breaker float64
+	switch s.Breaker {
+	case "open":
+		breaker = 1
+	case "half-open":
+		breaker = 2
+	}
+
+	metrics := []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"kulascope_queue_length", "gauge", "Records waiting in the send queue.", float64(s.QueueLength)},
+		{"kulascope_queue_capacity", "gauge", "Size of the send queue.", float64(s.QueueCapacity)},
+		{"kulascope_log_queue_length", "gauge", "AsyncLog calls waiting to be written.", float64(s.LogQueueLength)},
+		{"kulascope_log_queue_capacity", "gauge", "Size of the AsyncLog queue.", float64(s.LogQueueCapacity)},
+		{"kulascope_pending_records", "gauge", "Records queued, spilled or in flight.", float64(s.Pending)},
+		{"kulascope_records_delivered_total", "counter", "Records accepted by the exporter.", float64(s.Delivered)},
+		{"kulascope_records_failed_total", "counter", "Records given up on.", float64(s.Failed)},
+		{"kulascope_records_dropped_total", "counter", "Records dropped by the queue overflow policy.", float64(s.Dropped)},
+		{"kulascope_records_spilled_total", "counter", "Records spilled to the overflow directory.", float64(s.Spilled)},
+		{"kulascope_records_dead_lettered_total", "counter", "Records handed to the dead-letter sink.", float64(s.DeadLettered)},
+		{"kulascope_requests_sampled_out_total", "counter", "Requests not captured because of sampling.", float64(s.SampledOut)},
+		{"kulascope_async_logs_dropped_total", "counter", "AsyncLog calls dropped because the queue was full.", float64(s.LogDropped)},
+		{"kulascope_batches_sent_total", "counter", "Batches accepted by the exporter.", float64(s.BatchesSent)},
+		{"kulascope_batches_rejected_total", "counter", "Batches rejected by the exporter without retry.", float64(s.BatchesRejected)},
+		{"kulascope_bytes_sent_total", "counter", "Uncompressed bytes in delivered batches.", float64(s.BytesSent)},
+		{"kulascope_export_attempts_total", "counter", "Calls to the exporter.", float64(s.ExportAttempts)},
+		{"kulascope_export_retries_total", "counter", "Calls to the exporter that were retries.", float64(s.ExportRetries)},
+		{"kulascope_export_errors_total", "counter", "Calls to the exporter that failed.", float64(s.ExportErrors)},
+		{"kulascope_circuit_breaker_state", "gauge", "0 closed, 1 open, 2 half-open.", breaker},
+		{"kulascope_spool_bytes", "gauge", "Size of the spool on disk.", float64(s.SpoolBytes)},
+		{"kulascope_overflow_bytes", "gauge", "Size of the overflow spool on disk.", float64(s.OverflowBytes)},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", m.name, m.help, m.name, m.kind, m.name, formatFloat(m.value))
+	}
+	fmt.Fprintf(w, "# HELP kulascope_export_duration_seconds Time spent in the exporter.\n# TYPE kulascope_export_duration_seconds summary\n")
+	fmt.Fprintf(w, "kulascope_export_duration_seconds_sum %s\n", formatFloat(s.ExportTime.Seconds()))
+	fmt.Fprintf(w, "kulascope_export_duration_seconds_count %d\n", s.ExportAttempts)
+
+	if c.routeMetrics != nil {
+		c.routeMetrics.writePrometheus(w)
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// selfReporter queues the client's stats as a record every
+// SelfReportInterval until Shutdown
+func (c *Client) selfReporter() {
+	ticker := time.NewTicker(c.cfg.SelfReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.enqueue(CreateLogRequest{
+				TraceID:   uuid.New(),
+				Level:     "info",
+				Message:   "kulascope sdk stats",
+				Metadata:  map[string]any{"sdk_stats": c.Stats()},
+				Timestamp: time.Now(),
+			})
+		case <-c.stopLog:
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package kulascope
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatsCounters(t *testing.T) {
+	var reject atomic.Bool
+	reject.Store(true)
+	var deadLetters atomic.Int64
+	client, err := New(Config{
+		APIKey:         "test",
+		DisableBreaker: true,
+		Retry:          RetryPolicy{MaxRetries: -1},
+		DeadLetter: DeadLetterFunc(func(records []CreateLogRequest, _ error) error {
+			deadLetters.Add(int64(len(records)))
+			return nil
+		}),
+		Exporter: exporterFunc(func(context.Context, []CreateLogRequest) error {
+			if reject.Load() {
+				return Permanent(errors.New("bad request"))
+			}
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown(context.Background())
+
+	send := func() {
+		client.enqueue(CreateLogRequest{Level: "info", Message: "m", Timestamp: time.Now()})
+		client.Flush(context.Background())
+	}
+	send()
+	reject.Store(false)
+	send()
+
+	s := client.Stats()
+	for _, c := range []struct {
+		name      string
+		got, want int64
+	}{
+		{"Pending", s.Pending, 0},
+		{"Delivered", s.Delivered, 1},
+		{"Failed", s.Failed, 1},
+		{"DeadLettered", s.DeadLettered, 1},
+		{"BatchesSent", s.BatchesSent, 1},
+		{"BatchesRejected", s.BatchesRejected, 1},
+		{"ExportAttempts", s.ExportAttempts, 2},
+		{"ExportRetries", s.ExportRetries, 0},
+		{"ExportErrors", s.ExportErrors, 1},
+		{"dead-letter sink", deadLetters.Load(), 1},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s = %d, want %d", c.name, c.got, c.want)
+		}
+	}
+	if s.BytesSent <= 0 || s.QueueCapacity != client.cfg.QueueSize || s.Breaker != "" {
+		t.Errorf("BytesSent %d, QueueCapacity %d, Breaker %q", s.BytesSent, s.QueueCapacity, s.Breaker)
+	}
+}
+
+func TestPrometheusExposition(t *testing.T) {
+	client, _ := newTestClient(t, Config{})
+	client.observeRequest("GET", "/orders/:id", 20*time.Millisecond, false)
+	client.observeRequest("POST", "/say/\"hi\"\\\n", time.Second, true)
+
+	rec := httptest.NewRecorder()
+	client.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != metricsContentType {
+		t.Errorf("Content-Type %q", ct)
+	}
+	body := rec.Body.String()
+
+	// every sample belongs to a family announced by HELP and TYPE lines
+	help, kinds := map[string]bool{}, map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "# HELP "); ok {
+			name, _, _ = strings.Cut(name, " ")
+			help[name] = true
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, kind, _ := strings.Cut(rest, " ")
+			if !help[name] {
+				t.Errorf("TYPE before HELP for %s", name)
+			}
+			kinds[name] = kind
+			continue
+		}
+		name, _, _ := strings.Cut(line, " ")
+		name, _, _ = strings.Cut(name, "{")
+		family := name
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if base, ok := strings.CutSuffix(name, suffix); ok && (kinds[base] == "histogram" || kinds[base] == "summary") {
+				family = base
+			}
+		}
+		if kinds[family] == "" {
+			t.Errorf("sample %q has no TYPE line", line)
+		}
+	}
+
+	for _, line := range []string{
+		`kulascope_records_delivered_total 0`,
+		`kulascope_queue_capacity 50000`,
+		`kulascope_requests_total{method="GET",route="/orders/:id"} 1`,
+		`kulascope_request_errors_total{method="POST",route="/say/\"hi\"\\\n"} 1`,
+		`kulascope_request_duration_seconds_bucket{method="POST",route="/say/\"hi\"\\\n",le="+Inf"} 1`,
+		`kulascope_request_duration_seconds_count{method="GET",route="/orders/:id"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics missing %s", line)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package kulascope
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// spanContext is the trace context of the request being handled. It is
+// extracted from incoming headers and propagated to outbound calls.
+type spanContext struct {
+	traceID      uuid.UUID
+	spanID       string
+	parentSpanID string
+	traceState   string
+	sampled      bool
+}
+
+// extractSpanContext reads the incoming trace context, trying W3C
+// traceparent, B3 single header, B3 multi header and X-Request-ID in that
+// order. A new trace is started when none is present. The request always
+// gets a fresh span ID of its own.
+func extractSpanContext(get func(string) string) spanContext {
+	sc := spanContext{spanID: newSpanID(), sampled: true}
+
+	if tp := get("traceparent"); tp != "" {
+		if traceID, parent, sampled, ok := parseTraceParent(tp); ok {
+			sc.traceID = traceID
+			sc.parentSpanID = parent
+			sc.sampled = sampled
+			sc.traceState = get("tracestate")
+			return sc
+		}
+	}
+
+	if b3 := get("b3"); b3 != "" {
+		if traceID, parent, sampled, ok := parseB3Single(b3); ok {
+			sc.traceID = traceID
+			sc.parentSpanID = parent
+			sc.sampled = sampled
+			return sc
+		}
+	}
+
+	if tid := get("X-B3-TraceId"); tid != "" {
+		if traceID, ok := parseTraceID(tid); ok {
+			sc.traceID = traceID
+			if span := strings.ToLower(get("X-B3-SpanId")); isSpanID(span) {
+				sc.parentSpanID = span
+			}
+			sc.sampled = b3Sampled(get("X-B3-Sampled"), get("X-B3-Flags"))
+			return sc
+		}
+	}
+
+	if rid := strings.TrimSpace(get("X-Request-ID")); rid != "" {
+		if id, err := uuid.Parse(rid); err == nil {
+			sc.traceID = id
+		} else {
+			// non-UUID request IDs map to a stable trace ID
+			sc.traceID = uuid.NewSHA1(uuid.NameSpaceOID, []byte(rid))
+		}
+		return sc
+	}
+
+	sc.traceID = uuid.New()
+	return sc
+}
+
+// parseTraceParent parses a W3C traceparent header:
+// version-traceid-parentid-flags
+func parseTraceParent(v string) (uuid.UUID, string, bool, bool) {
+	parts := strings.Split(strings.TrimSpace(strings.ToLower(v)), "-")
+	if len(parts) < 4 || !isHex(parts[0], 2) || parts[0] == "ff" {
+		return uuid.Nil, "", false, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return uuid.Nil, "", false, false
+	}
+	traceID, ok := parseTraceID(parts[1])
+	if !ok || len(parts[1]) != 32 {
+		return uuid.Nil, "", false, false
+	}
+	if !isSpanID(parts[2]) || !isHex(parts[3], 2) {
+		return uuid.Nil, "", false, false
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	return traceID, parts[2], flags[0]&0x01 == 1, true
+}
+
+// parseB3Single parses the b3 header: traceid-spanid[-sampled[-parentspanid]]
+func parseB3Single(v string) (uuid.UUID, string, bool, bool) {
+	parts := strings.Split(strings.TrimSpace(strings.ToLower(v)), "-")
+	if len(parts) < 2 {
+		return uuid.Nil, "", false, false
+	}
+	traceID, ok := parseTraceID(parts[0])
+	if !ok || !isSpanID(parts[1]) {
+		return uuid.Nil, "", false, false
+	}
+	sampled := true
+	if len(parts) > 2 {
+		sampled = b3Sampled(parts[2], "")
+	}
+	return traceID, parts[1], sampled, true
+}
+
+func b3Sampled(sampled, flags string) bool {
+	if flags == "1" {
+		return true
+	}
+	switch strings.ToLower(sampled) {
+	case "0", "false":
+		return false
+	default:
+		return true
+	}
+}
+
+// parseTraceID accepts 128-bit and 64-bit hex trace IDs; 64-bit IDs are
+// left-padded with zeros
+func parseTraceID(v string) (uuid.UUID, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if isHex(v, 16) {
+		v = strings.Repeat("0", 16) + v
+	}
+	if !isHex(v, 32) || v == strings.Repeat("0", 32) {
+		return uuid.Nil, false
+	}
+	var id uuid.UUID
+	hex.Decode(id[:], []byte(v))
+	return id, true
+}
+
+// isSpanID reports whether s is a valid, non-zero 64-bit hex span ID
+func isSpanID(s string) bool {
+	return isHex(s, 16) && s != strings.Repeat("0", 16)
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func newSpanID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// traceParent renders the W3C traceparent header to send downstream, with
+// this request's span as the parent
+func (sc spanContext) traceParent() string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.traceID[:]) + "-" + sc.spanID + "-" + flags
+}
+
+func withSpanContext(ctx context.Context, sc spanContext) context.Context {
+	return context.WithValue(ctx, spanKey, sc)
+}
+
+func spanContextFrom(ctx context.Context) (spanContext, bool) {
+	sc, ok := ctx.Value(spanKey).(spanContext)
+	return sc, ok
+}
+
+// apply records the trace context on the log payload
+func (sc spanContext) apply(req *CreateLogRequest) {
+	req.SpanID = &sc.spanID
+	if sc.parentSpanID != "" {
+		req.ParentSpanID = &sc.parentSpanID
+	}
+	req.Sampled = &sc.sampled
+	if sc.traceState != "" {
+		req.Metadata["tracestate"] = sc.traceState
+	}
+}
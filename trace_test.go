@@ -0,0 +1,127 @@
+package kulascope
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	for _, tc := range []struct {
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"00-" + testTraceID + "-" + testSpanID + "-01", true, true},
+		{"00-" + testTraceID + "-" + testSpanID + "-00", true, false},
+		{" 00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01 ", true, true},
+		// later versions may append fields
+		{"01-" + testTraceID + "-" + testSpanID + "-01-extra", true, true},
+		{"00-" + testTraceID + "-" + testSpanID + "-01-extra", false, false},
+		{"ff-" + testTraceID + "-" + testSpanID + "-01", false, false},
+		{"00-00000000000000000000000000000000-" + testSpanID + "-01", false, false},
+		{"00-" + testTraceID + "-0000000000000000-01", false, false},
+		{"00-" + testTraceID[:16] + "-" + testSpanID + "-01", false, false},
+		{"00-" + testTraceID + "-" + testSpanID[:8] + "-01", false, false},
+		{"00-" + testTraceID + "-" + testSpanID + "-zz", false, false},
+		{"00-" + testTraceID + "-" + testSpanID, false, false},
+		{"garbage", false, false},
+	} {
+		traceID, parent, sampled, ok := parseTraceParent(tc.header)
+		if ok != tc.ok {
+			t.Errorf("%q: ok = %v, want %v", tc.header, ok, tc.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if traceID != uuid.MustParse(testTraceID) || parent != testSpanID || sampled != tc.sampled {
+			t.Errorf("%q = %s, %s, %v", tc.header, traceID, parent, sampled)
+		}
+	}
+}
+
+func TestParseB3Single(t *testing.T) {
+	for _, tc := range []struct {
+		header  string
+		ok      bool
+		traceID string
+		sampled bool
+	}{
+		{testTraceID + "-" + testSpanID, true, testTraceID, true},
+		{testTraceID + "-" + testSpanID + "-1", true, testTraceID, true},
+		{testTraceID + "-" + testSpanID + "-0", true, testTraceID, false},
+		{testTraceID + "-" + testSpanID + "-d-05e3ac9a4f6e3b90", true, testTraceID, true},
+		// 64-bit trace IDs are left-padded
+		{"a3ce929d0e0e4736-" + testSpanID + "-1", true, "0000000000000000a3ce929d0e0e4736", true},
+		{"00000000000000000000000000000000-" + testSpanID, false, "", false},
+		{testTraceID + "-0000000000000000", false, "", false},
+		{testTraceID + "-" + testSpanID[:8], false, "", false},
+		{"xyz-" + testSpanID, false, "", false},
+		{"0", false, "", false},
+		{"", false, "", false},
+	} {
+		traceID, parent, sampled, ok := parseB3Single(tc.header)
+		if ok != tc.ok {
+			t.Errorf("%q: ok = %v, want %v", tc.header, ok, tc.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if traceID != uuid.MustParse(tc.traceID) || parent != testSpanID || sampled != tc.sampled {
+			t.Errorf("%q = %s, %s, %v", tc.header, traceID, parent, sampled)
+		}
+	}
+}
+
+func TestExtractSpanContext(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		traceID string
+		parent  string
+		sampled bool
+	}{
+		{
+			name:    "traceparent wins over b3",
+			headers: map[string]string{"traceparent": "00-" + testTraceID + "-" + testSpanID + "-00", "b3": "a3ce929d0e0e4736-05e3ac9a4f6e3b90"},
+			traceID: testTraceID, parent: testSpanID, sampled: false,
+		},
+		{
+			name:    "invalid traceparent falls back to b3",
+			headers: map[string]string{"traceparent": "00-bad", "b3": testTraceID + "-" + testSpanID + "-1"},
+			traceID: testTraceID, parent: testSpanID, sampled: true,
+		},
+		{
+			name:    "b3 multi header",
+			headers: map[string]string{"X-B3-TraceId": testTraceID, "X-B3-SpanId": testSpanID, "X-B3-Sampled": "0"},
+			traceID: testTraceID, parent: testSpanID, sampled: false,
+		},
+		{
+			name:    "b3 multi header with zero span",
+			headers: map[string]string{"X-B3-TraceId": testTraceID, "X-B3-SpanId": "0000000000000000"},
+			traceID: testTraceID, sampled: true,
+		},
+		{
+			name:    "request ID",
+			headers: map[string]string{"X-Request-ID": "4bf92f35-77b3-4da6-a3ce-929d0e0e4736"},
+			traceID: testTraceID, sampled: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sc := extractSpanContext(func(k string) string { return tc.headers[k] })
+			if sc.traceID != uuid.MustParse(tc.traceID) || sc.parentSpanID != tc.parent || sc.sampled != tc.sampled {
+				t.Errorf("got %s, %q, %v", sc.traceID, sc.parentSpanID, sc.sampled)
+			}
+			if !isSpanID(sc.spanID) || sc.spanID == tc.parent {
+				t.Errorf("span ID = %q, want a fresh one", sc.spanID)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package kulascope
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kulawise/kulascope-go-sdk/log"
+	"github.com/kulawise/kulascope-go-sdk/redact"
+)
+
+// Transport wraps base so that every outbound call is recorded as a sub-log
+// of the current request and carries its trace ID downstream. Redaction
+// rules come from the client handling the request, or the default client.
+// A nil base uses http.DefaultTransport.
+//
+// A call with a response body is recorded once the body is read to EOF or
+// closed, so the entry holds the body and its latency covers reading it.
+// Close the body before the handler returns, or the call is missing from
+// the request's record.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+// Transport is like the package-level Transport but always uses this
+// client's redaction rules
+func (c *Client) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, client: c}
+}
+
+type transport struct {
+	base   http.RoundTripper
+	client *Client
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	events := log.FromContext(ctx)
+
+	client := t.rules(ctx)
+	reqLimit, respLimit := outboundBodyLimits(client)
+
+	// RoundTrippers must not modify the caller's request
+	out := req.Clone(ctx)
+	reqBody, err := captureRequestBody(req, out, reqLimit)
+	if err != nil {
+		return nil, err
+	}
+	if sc, ok := outboundSpanContext(ctx, events); ok {
+		out.Header.Set("traceparent", sc.traceParent())
+		if sc.traceState != "" {
+			out.Header.Set("tracestate", sc.traceState)
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(out)
+
+	call := &outboundCall{
+		client:  client,
+		events:  events,
+		start:   start,
+		method:  out.Method,
+		url:     out.URL.String(),
+		reqHdrs: cloneHeaders(req.Header),
+		reqBody: reqBody,
+		err:     err,
+	}
+	if err != nil || resp == nil {
+		call.record()
+		return resp, err
+	}
+
+	call.status = resp.StatusCode
+	call.respHdrs = cloneHeaders(resp.Header)
+	if resp.Body == nil || resp.Body == http.NoBody {
+		call.record()
+		return resp, nil
+	}
+
+	// the entry is written once the caller has finished with the body
+	resp.Body = &capturingBody{ReadCloser: resp.Body, call: call, limit: respLimit}
+	return resp, nil
+}
+
+// rules returns the client whose redaction rules apply to this call
+func (t *transport) rules(ctx context.Context) *Client {
+	if t.client != nil {
+		return t.client
+	}
+	return clientFromContext(ctx)
+}
+
+// outboundBodyLimits returns how much of an outbound request and response
+// body is captured: the client's MaxRequestBodyBytes and
+// MaxResponseBodyBytes, or their defaults when there is no client
+func outboundBodyLimits(c *Client) (request, response int) {
+	if c == nil {
+		return defaultMaxBodyBytes, defaultMaxBodyBytes
+	}
+	return c.cfg.MaxRequestBodyBytes, c.cfg.MaxResponseBodyBytes
+}
+
+// limitReader is io.LimitReader, with a negative limit reading everything
+func limitReader(r io.Reader, limit int) io.Reader {
+	if limit < 0 {
+		return r
+	}
+	return io.LimitReader(r, int64(limit))
+}
+
+// captureRequestBody reads up to limit bytes of the request body without
+// consuming it for the actual request. Past the limit, the body is
+// streamed on to the server as it is read. A failed read is returned, and
+// the body closed, instead of sending part of it.
+func captureRequestBody(orig, out *http.Request, limit int) ([]byte, error) {
+	if orig.Body == nil || orig.Body == http.NoBody {
+		return nil, nil
+	}
+	if orig.GetBody != nil {
+		rc, err := orig.GetBody()
+		if err != nil {
+			return nil, nil
+		}
+		defer rc.Close()
+		b, _ := io.ReadAll(limitReader(rc, limit))
+		return b, nil
+	}
+
+	b, err := io.ReadAll(limitReader(orig.Body, limit))
+	if err != nil {
+		orig.Body.Close()
+		return nil, fmt.Errorf("kulascope: read request body: %w", err)
+	}
+	out.Body = readCloser{io.MultiReader(bytes.NewReader(b), orig.Body), orig.Body}
+	return b, nil
+}
+
+// outboundSpanContext returns the trace context to propagate downstream.
+// Outside the SDK's middleware, a span is derived from the EventLogger's trace ID.
+func outboundSpanContext(ctx context.Context, events *log.EventLogger) (spanContext, bool) {
+	if sc, ok := spanContextFrom(ctx); ok {
+		return sc, true
+	}
+	if traceID := events.TraceID(); traceID != uuid.Nil {
+		return spanContext{traceID: traceID, spanID: newSpanID(), sampled: true}, true
+	}
+	return spanContext{}, false
+}
+
+// outboundCall collects one outbound request until its response body is closed
+type outboundCall struct {
+	client   *Client
+	events   *log.EventLogger
+	start    time.Time
+	method   string
+	url      string
+	status   int
+	reqHdrs  map[string][]string
+	reqBody  []byte
+	respHdrs map[string][]string
+	respBody bytes.Buffer
+	err      error
+	once     sync.Once
+}
+
+func (oc *outboundCall) record() {
+	oc.once.Do(func() {
+		headerRules := redact.Lenient(redact.Options{Rules: defaultRedactHeaderKeys})
+		reqRules := redact.Lenient(redact.Options{Rules: defaultRedactBodyKeys})
+		respRules := reqRules
+		if oc.client != nil {
+			headerRules = oc.client.headerRules
+			reqRules = oc.client.requestRules
+			respRules = oc.client.responseRules
+		}
+
+		ev := oc.events.Info()
+		if oc.err != nil || oc.status >= 500 {
+			ev = oc.events.Error()
+		}
+
+		ev.Str("type", "http_client").
+			Str("method", oc.method).
+			Str("url", reqRules.URL(oc.url)).
+			Int("status", oc.status).
+			Int("latency", int(time.Since(oc.start).Milliseconds())).
+			Interface("request_headers", redactURLHeaders(headerRules.Headers(oc.reqHdrs), reqRules)).
+			Str("request_body", string(reqRules.Body(oc.reqBody, first(oc.reqHdrs["Content-Type"]))))
+		if oc.respHdrs != nil {
+			ev.Interface("response_headers", redactURLHeaders(headerRules.Headers(oc.respHdrs), reqRules)).
+				Str("response_body", string(respRules.Body(oc.respBody.Bytes(), first(oc.respHdrs["Content-Type"]))))
+		}
+		ev.Err(oc.err).Msg("outbound request")
+	})
+}
+
+// capturingBody copies what the caller reads from a response body and
+// records the outbound call on EOF or Close
+type capturingBody struct {
+	io.ReadCloser
+	call  *outboundCall
+	limit int // negative keeps the whole body
+}
+
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	room := b.limit - b.call.respBody.Len()
+	if b.limit < 0 {
+		room = n
+	}
+	if room > 0 && n > 0 {
+		b.call.respBody.Write(p[:min(n, room)])
+	}
+	if err == io.EOF {
+		b.call.record()
+	}
+	return n, err
+}
+
+func (b *capturingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.call.record()
+	return err
+}
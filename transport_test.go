@@ -0,0 +1,143 @@
+package kulascope
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kulawise/kulascope-go-sdk/log"
+)
+
+// failingReader returns data, then err
+type failingReader struct {
+	data string
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestTransportRequestBody(t *testing.T) {
+	var received []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+	rt := Transport(nil)
+
+	t.Run("read error", func(t *testing.T) {
+		received = nil
+		readErr := errors.New("disk gone")
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, io.NopCloser(&failingReader{data: "aaa", err: readErr}))
+		if resp, err := rt.RoundTrip(req); !errors.Is(err, readErr) {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			t.Fatalf("RoundTrip error = %v, want %v", err, readErr)
+		}
+		if received != nil {
+			t.Fatalf("server got %q from a body that failed to read", received)
+		}
+	})
+
+	t.Run("past the limit", func(t *testing.T) {
+		body := strings.Repeat("x", defaultMaxBodyBytes+100)
+		orig, out := &http.Request{Body: io.NopCloser(strings.NewReader(body))}, &http.Request{}
+		captured, err := captureRequestBody(orig, out, defaultMaxBodyBytes)
+		if err != nil || len(captured) != defaultMaxBodyBytes {
+			t.Fatalf("captured %d bytes, %v; want %d", len(captured), err, defaultMaxBodyBytes)
+		}
+		sent, _ := io.ReadAll(out.Body)
+		if !bytes.Equal(sent, []byte(body)) {
+			t.Fatalf("streamed %d bytes, want %d", len(sent), len(body))
+		}
+	})
+}
+
+func TestTransportBodyLimitsFromConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		io.WriteString(w, "goodbye world")
+	}))
+	defer srv.Close()
+
+	client, _ := newTestClient(t, Config{MaxRequestBodyBytes: 4, MaxResponseBodyBytes: 7})
+	ctx := client.newContext(context.Background(), extractSpanContext(func(string) string { return "" }))
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL, strings.NewReader("hello world"))
+	resp, err := client.Transport(nil).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	subLogs := log.SubLogsFromContext(ctx)
+	if len(subLogs) != 1 {
+		t.Fatalf("%d sub-logs, want 1", len(subLogs))
+	}
+	meta := subLogs[0].Metadata
+	if meta["request_body"] != "hell" || meta["response_body"] != "goodbye" {
+		t.Errorf("captured %q and %q, want the configured 4 and 7 bytes", meta["request_body"], meta["response_body"])
+	}
+}
+
+func TestTransportRecordsOnBodyDone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		io.WriteString(w, "pong")
+	}))
+	defer srv.Close()
+
+	client, _ := newTestClient(t, Config{})
+	rt := client.Transport(nil)
+	call := func(path string) (context.Context, *http.Response) {
+		t.Helper()
+		ctx := client.newContext(context.Background(), extractSpanContext(func(string) string { return "" }))
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path, nil)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ctx, resp
+	}
+
+	ctx, resp := call("/ping")
+	if n := len(log.SubLogsFromContext(ctx)); n != 0 {
+		t.Fatalf("%d sub-logs before the body was read, want 0", n)
+	}
+	resp.Body.Close()
+	if subLogs := log.SubLogsFromContext(ctx); len(subLogs) != 1 {
+		t.Fatalf("%d sub-logs after Close, want 1", len(subLogs))
+	}
+
+	ctx, resp = call("/ping")
+	io.ReadAll(resp.Body)
+	subLogs := log.SubLogsFromContext(ctx)
+	if len(subLogs) != 1 || subLogs[0].Metadata["response_body"] != "pong" {
+		t.Fatalf("sub-logs after EOF %+v, want one with the body", subLogs)
+	}
+	resp.Body.Close()
+	if n := len(log.SubLogsFromContext(ctx)); n != 1 {
+		t.Fatalf("%d sub-logs after EOF and Close, want 1", n)
+	}
+
+	ctx, resp = call("/empty")
+	if n := len(log.SubLogsFromContext(ctx)); n != 1 {
+		t.Fatalf("%d sub-logs for a call without a body, want 1 right away", n)
+	}
+	resp.Body.Close()
+}